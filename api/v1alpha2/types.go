@@ -15,6 +15,11 @@ limitations under the License.
 
 package v1alpha2
 
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
 // APIEndpoint represents control-plane's apiserver endpoints.
 type APIEndpoint struct {
 	// ID is the id of Vultr reserved IP (SUBID).
@@ -57,3 +62,105 @@ var (
 	ServerStateIsoMounting = ServerState("isomounting")
 	ServerStateOK          = ServerState("ok")
 )
+
+// FailureDomainSpec is the Vultr region backing a failure domain.
+type FailureDomainSpec struct {
+	// Region is the Vultr Region (DCID) of the failure domain.
+	Region int `json:"region"`
+
+	// ControlPlane determines if the failure domain is suitable for control-plane machines.
+	// +optional
+	ControlPlane bool `json:"controlPlane,omitempty"`
+}
+
+// FailureDomains is a map of failure domain names to their spec.
+type FailureDomains map[string]FailureDomainSpec
+
+// InstanceClass is the class of Vultr instance a VultrMachine runs on.
+// +kubebuilder:validation:Enum=CloudCompute;BareMetal
+type InstanceClass string
+
+var (
+	// CloudComputeInstanceClass is a cloud compute server, including
+	// high-frequency and dedicated cloud ones.
+	CloudComputeInstanceClass = InstanceClass("CloudCompute")
+
+	// BareMetalInstanceClass is a bare metal server.
+	BareMetalInstanceClass = InstanceClass("BareMetal")
+)
+
+// IPFamily is the IP family of the API endpoint of a VultrCluster.
+// +kubebuilder:validation:Enum=IPv4;DualStack
+type IPFamily string
+
+var (
+	// IPv4IPFamily is an IPv4 API endpoint.
+	IPv4IPFamily = IPFamily("IPv4")
+
+	// DualStackIPFamily is an IPv4 API endpoint, with an IPv6 reserved IP
+	// attached to a control-plane server as well.
+	DualStackIPFamily = IPFamily("DualStack")
+)
+
+// DeletionPolicy is what happens to the server of a VultrMachine when it is deleted.
+// +kubebuilder:validation:Enum=Delete;SnapshotThenDelete
+type DeletionPolicy string
+
+var (
+	// DeleteDeletionPolicy deletes the server.
+	DeleteDeletionPolicy = DeletionPolicy("Delete")
+
+	// SnapshotThenDeleteDeletionPolicy takes a snapshot of the server and
+	// deletes the server once the snapshot is complete.
+	SnapshotThenDeleteDeletionPolicy = DeletionPolicy("SnapshotThenDelete")
+)
+
+// ResizePolicy is how changes to the plan of a VultrMachine are applied.
+// +kubebuilder:validation:Enum=Never;InPlace
+type ResizePolicy string
+
+var (
+	// NeverResizePolicy ignores changes to the plan of the VultrMachine.
+	NeverResizePolicy = ResizePolicy("Never")
+
+	// InPlaceResizePolicy upgrades the server to the plan of the VultrMachine.
+	// Servers can only be upgraded to larger plans.
+	InPlaceResizePolicy = ResizePolicy("InPlace")
+)
+
+// ConditionType is the type of a condition of a VultrMachine.
+type ConditionType string
+
+var (
+	// ResizedCondition reports whether the server runs the plan of the VultrMachine.
+	ResizedCondition = ConditionType("Resized")
+
+	// ReinstalledCondition reports the progress of the reinstall requested by
+	// the ReinstallAnnotation.
+	ReinstalledCondition = ConditionType("Reinstalled")
+
+	// AutoBackupsCondition reports whether the automatic backups of the server
+	// match the VultrMachine.
+	AutoBackupsCondition = ConditionType("AutoBackups")
+)
+
+// Condition is an observation of the state of a VultrMachine.
+type Condition struct {
+	// Type of the condition.
+	Type ConditionType `json:"type"`
+
+	// Status of the condition, one of True, False or Unknown.
+	Status corev1.ConditionStatus `json:"status"`
+
+	// LastTransitionTime is the last time the condition changed from one status to another.
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// Reason is a CamelCase reason for the last transition of the condition.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Message is a human readable message about the last transition.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
@@ -16,11 +16,26 @@ limitations under the License.
 package v1alpha2
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capierrors "sigs.k8s.io/cluster-api/errors"
 )
 
 const (
 	ClusterFinalizer = "vultrcluster.infrastructure.cluster.x-k8s.io"
+
+	// CredentialsSecretKey is the key of the Vultr API key in the credentials secret.
+	CredentialsSecretKey = "vultr-api-key"
+
+	// ClusterctlMoveLabel is the label that makes clusterctl move an object
+	// which is not part of the Cluster API object graph, such as a secret.
+	ClusterctlMoveLabel = "clusterctl.cluster.x-k8s.io/move"
+
+	// OwnerIDAnnotation is the annotation that holds the id identifying the
+	// Vultr resources owned by the VultrCluster. It is set to the UID of the
+	// VultrCluster on creation, and kept when the UID changes on clusterctl move.
+	// It can be set by hand to the former UID of a cluster moved before it was recorded.
+	OwnerIDAnnotation = "vultr.cluster.x-k8s.io/owner-id"
 )
 
 // VultrClusterSpec defines the desired state of VultrCluster
@@ -29,6 +44,47 @@ type VultrClusterSpec struct {
 
 	// The Vultr Region (DCID) the cluster lives in.
 	Region int `json:"region"`
+
+	// CredentialsSecret is a reference to the secret in the same namespace
+	// holding the Vultr API key. If not set, the API key of the manager is used.
+	// +optional
+	CredentialsSecret *corev1.LocalObjectReference `json:"credentialsSecret,omitempty"`
+
+	// ReservedIPID is the id of the Vultr reserved IP (SUBID) used as the
+	// control-plane endpoint. It is set by the controller once the reserved IP
+	// is created, so that the cluster can be moved without recreating it.
+	// +optional
+	ReservedIPID string `json:"reservedIPID,omitempty"`
+
+	// IPFamily is the IP family of the control-plane endpoint. IPv4 uses a
+	// single IPv4 reserved IP, while DualStack also reserves an IPv6 subnet,
+	// recorded in ReservedIPv6ID, and attaches it to a control-plane server.
+	// The provider does not configure an address of the IPv6 subnet on the
+	// servers, so it is not published in the API endpoints: the bootstrap
+	// data may configure one. IPv6-only clusters are not supported.
+	// Machines of DualStack clusters always have IPv6 enabled.
+	// It cannot be changed once the endpoint is reserved. Defaults to IPv4.
+	// +optional
+	IPFamily IPFamily `json:"ipFamily,omitempty"`
+
+	// ReservedIPv6ID is the id of the Vultr IPv6 reserved IP (SUBID) attached
+	// to a control-plane server of a DualStack cluster. It is set by the controller.
+	// +optional
+	ReservedIPv6ID string `json:"reservedIPv6ID,omitempty"`
+
+	// AdditionalTags is the set of tags added to the servers of all the
+	// machines of the cluster, in addition to the standard tags set by the
+	// provider. Vultr servers have a single tag, so the tags are encoded in it
+	// as a comma-separated list of key=value pairs. Keys must not contain ','
+	// or '=', and values must not contain ','.
+	// +optional
+	AdditionalTags map[string]string `json:"additionalTags,omitempty"`
+
+	// FailureDomains is the set of failure domains the machines of the
+	// cluster can be spread over, keyed by name. Machines without a failure
+	// domain are created in Region.
+	// +optional
+	FailureDomains FailureDomains `json:"failureDomains,omitempty"`
 }
 
 // VultrClusterStatus defines the observed state of VultrCluster
@@ -36,6 +92,22 @@ type VultrClusterStatus struct {
 	Ready bool `json:"ready"`
 	// +optional
 	APIEndpoints []APIEndpoint `json:"apiEndpoints,omitempty"`
+
+	// FailureDomains is the set of failure domains available to the machines of the cluster.
+	// +optional
+	FailureDomains FailureDomains `json:"failureDomains,omitempty"`
+
+	// ErrorReason will be set in the event that there is a terminal problem
+	// reconciling the Cluster and will contain a succinct value suitable
+	// for machine interpretation.
+	// +optional
+	ErrorReason *capierrors.ClusterStatusError `json:"errorReason,omitempty"`
+
+	// ErrorMessage will be set in the event that there is a terminal problem
+	// reconciling the Cluster and will contain a more verbose string suitable
+	// for logging and human consumption.
+	// +optional
+	ErrorMessage *string `json:"errorMessage,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -59,6 +131,16 @@ type VultrClusterList struct {
 	Items           []VultrCluster `json:"items"`
 }
 
+// OwnerID returns the id identifying the Vultr resources owned by the
+// VultrCluster, which is its UID until the OwnerIDAnnotation is set.
+func (c *VultrCluster) OwnerID() string {
+	if id := c.Annotations[OwnerIDAnnotation]; id != "" {
+		return id
+	}
+
+	return string(c.UID)
+}
+
 func init() {
 	SchemeBuilder.Register(&VultrCluster{}, &VultrClusterList{})
 }
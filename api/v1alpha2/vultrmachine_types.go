@@ -17,10 +17,46 @@ package v1alpha2
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capierrors "sigs.k8s.io/cluster-api/errors"
 )
 
 const (
 	MachineFinalizer = "vultrmachine.infrastructure.cluster.x-k8s.io"
+
+	// AdoptServerAnnotation is the annotation that holds the id of a
+	// pre-existing Vultr server (SUBID) to be adopted by the VultrMachine
+	// instead of creating a new one.
+	AdoptServerAnnotation = "vultr.cluster.x-k8s.io/adopt-server"
+
+	// RetainAnnotation is the annotation that keeps the Vultr resources of a
+	// VultrMachine or VultrCluster when it is deleted. On a VultrCluster, the
+	// servers of all its machines are kept as well. Retained servers are
+	// untagged, so that they are no longer considered owned by the cluster.
+	RetainAnnotation = "vultr.cluster.x-k8s.io/retain"
+
+	// ReinstallAnnotation is the annotation that requests the server of the
+	// VultrMachine to be reinstalled, e.g. to remediate a wedged node while
+	// keeping its IP addresses. The server boots again with its original user
+	// data, and the annotation is removed once the reinstall has completed.
+	ReinstallAnnotation = "vultr.cluster.x-k8s.io/reinstall"
+
+	// RebootAnnotation is the annotation that requests the server of the
+	// VultrMachine to be rebooted. It is removed once the reboot is requested.
+	RebootAnnotation = "vultr.cluster.x-k8s.io/reboot"
+
+	// HaltAnnotation is the annotation that requests the server of the
+	// VultrMachine to be halted. It is removed once the halt is requested.
+	// The server is started again if the PowerState of the VultrMachine is running.
+	HaltAnnotation = "vultr.cluster.x-k8s.io/halt"
+
+	// ConfirmDeletionAnnotation is the annotation that allows the server of a
+	// VultrMachine with deletion protection to be deleted. If its value is
+	// "snapshot", a snapshot of the server is taken before it is deleted.
+	ConfirmDeletionAnnotation = "vultr.cluster.x-k8s.io/confirm-deletion"
+
+	// ConfirmDeletionSnapshot is the value of the ConfirmDeletionAnnotation
+	// requesting a snapshot of the server before it is deleted.
+	ConfirmDeletionSnapshot = "snapshot"
 )
 
 // VultrMachineSpec defines the desired state of VultrMachine
@@ -31,14 +67,80 @@ type VultrMachineSpec struct {
 	// OSID is the id of operating system (OSID).
 	OSID int `json:"osID,omitempty"`
 
+	// InstanceClass is the class of instance the machine runs on. Cloud compute
+	// servers, including high-frequency and dedicated cloud ones, which only
+	// differ by their plan, are selected by PlanID. Bare metal servers are
+	// managed with the bare metal API and PlanID is a bare metal plan
+	// (METALPLANID). Defaults to CloudCompute.
+	// +optional
+	InstanceClass InstanceClass `json:"instanceClass,omitempty"`
+
 	// PlanID is the id of Vultr VPS plan (VPSPLANID).
 	PlanID int `json:"planID,omitempty"`
 
+	// ResizePolicy is how changes to PlanID are applied to the server.
+	// Not supported for bare metal. Defaults to Never.
+	// +optional
+	ResizePolicy ResizePolicy `json:"resizePolicy,omitempty"`
+
 	// SSHKeyName is the name of the ssh key to attach to the instance.
 	SSHKeyName string `json:"sshKeyName,omitempty"`
 
 	// ScriptID is the id of Startup Script (SCRIPTID).
 	ScriptID int `json:"scriptID,omitempty"`
+
+	// AdditionalTags is the set of tags added to the server, in addition to
+	// the standard tags set by the provider and the additional tags of the
+	// VultrCluster, which it overrides. See VultrClusterSpec.AdditionalTags
+	// for how tags are encoded.
+	// +optional
+	AdditionalTags map[string]string `json:"additionalTags,omitempty"`
+
+	// PowerState is the desired power state of the server, either running or
+	// stopped. The power state is not managed if it is unset. Not supported
+	// for bare metal.
+	// +kubebuilder:validation:Enum=running;stopped
+	// +optional
+	PowerState PowerStatus `json:"powerState,omitempty"`
+
+	// DeletionPolicy is what happens to the server when the VultrMachine is
+	// deleted. Bare metal servers cannot be snapshotted. Defaults to Delete.
+	// +optional
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// DeletionProtection prevents the VultrMachine and its server from being
+	// deleted until the VultrMachine has the ConfirmDeletionAnnotation.
+	// +optional
+	DeletionProtection bool `json:"deletionProtection,omitempty"`
+
+	// EnableAutoBackups enables Vultr automatic backups of the server.
+	// Backups are enabled on existing servers too, but never disabled, as
+	// that discards them; this is reported in the AutoBackups condition.
+	// Not supported for bare metal.
+	// +optional
+	EnableAutoBackups bool `json:"enableAutoBackups,omitempty"`
+
+	// DDoSProtection enables Vultr DDoS protection of the server, which is
+	// charged separately and only available in some regions. It is only
+	// applied when the server is created. Not supported for bare metal.
+	// +optional
+	DDoSProtection bool `json:"ddosProtection,omitempty"`
+
+	// NotifyActivate sends an email to the Vultr account when the server is
+	// activated. Defaults to true.
+	// +optional
+	NotifyActivate *bool `json:"notifyActivate,omitempty"`
+
+	// EnableIPv6 enables IPv6 networking on the server. It is always enabled
+	// for the machines of DualStack clusters.
+	// +optional
+	EnableIPv6 bool `json:"enableIPv6,omitempty"`
+
+	// FailureDomain is the name of the VultrCluster failure domain the server
+	// is created in. Machines of the Cluster API release in use have no failure
+	// domain, so it is set here. If not set, the VultrCluster region is used.
+	// +optional
+	FailureDomain *string `json:"failureDomain,omitempty"`
 }
 
 // VultrMachineStatus defines the observed state of VultrMachine
@@ -54,6 +156,28 @@ type VultrMachineStatus struct {
 
 	// ServerState represents a detail of server state.
 	ServerState *ServerState `json:"serverState,omitempty"`
+
+	// DeletionSnapshotID is the id of the snapshot (SNAPSHOTID) of the server
+	// taken before it is deleted, as requested by the SnapshotThenDelete
+	// deletion policy or the ConfirmDeletionAnnotation.
+	// +optional
+	DeletionSnapshotID string `json:"deletionSnapshotID,omitempty"`
+
+	// Conditions are the observations of the state of the VultrMachine.
+	// +optional
+	Conditions []Condition `json:"conditions,omitempty"`
+
+	// ErrorReason will be set in the event that there is a terminal problem
+	// reconciling the Machine and will contain a succinct value suitable
+	// for machine interpretation.
+	// +optional
+	ErrorReason *capierrors.MachineStatusError `json:"errorReason,omitempty"`
+
+	// ErrorMessage will be set in the event that there is a terminal problem
+	// reconciling the Machine and will contain a more verbose string suitable
+	// for logging and human consumption.
+	// +optional
+	ErrorMessage *string `json:"errorMessage,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -0,0 +1,85 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+func (r *VultrMachine) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// +kubebuilder:webhook:verbs=create;update;delete,path=/validate-infrastructure-cluster-x-k8s-io-v1alpha2-vultrmachine,mutating=false,failurePolicy=fail,groups=infrastructure.cluster.x-k8s.io,resources=vultrmachines,versions=v1alpha2,name=validation.vultrmachine.infrastructure.cluster.x-k8s.io
+
+var _ webhook.Validator = &VultrMachine{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *VultrMachine) ValidateCreate() error {
+	return r.validateSpec()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *VultrMachine) ValidateUpdate(old runtime.Object) error {
+	return r.validateSpec()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *VultrMachine) ValidateDelete() error {
+	if r.Spec.DeletionProtection {
+		if _, ok := r.Annotations[ConfirmDeletionAnnotation]; !ok {
+			return errors.Errorf("VultrMachine %q has deletion protection: set the %s annotation to delete it",
+				r.Name, ConfirmDeletionAnnotation)
+		}
+	}
+
+	return nil
+}
+
+func (r *VultrMachine) validateSpec() error {
+	if r.Spec.InstanceClass != BareMetalInstanceClass {
+		return nil
+	}
+
+	if r.Spec.DeletionPolicy == SnapshotThenDeleteDeletionPolicy {
+		return errors.Errorf("deletionPolicy %s is not supported for instanceClass %s",
+			SnapshotThenDeleteDeletionPolicy, BareMetalInstanceClass)
+	}
+
+	if r.Spec.ResizePolicy == InPlaceResizePolicy {
+		return errors.Errorf("resizePolicy %s is not supported for instanceClass %s",
+			InPlaceResizePolicy, BareMetalInstanceClass)
+	}
+
+	if r.Spec.PowerState != "" {
+		return errors.Errorf("powerState is not supported for instanceClass %s", BareMetalInstanceClass)
+	}
+
+	if r.Spec.DDoSProtection {
+		return errors.Errorf("ddosProtection is not supported for instanceClass %s", BareMetalInstanceClass)
+	}
+
+	if r.Spec.EnableAutoBackups {
+		return errors.Errorf("enableAutoBackups is not supported for instanceClass %s", BareMetalInstanceClass)
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+// createError wraps an error returned by the Vultr API when creating a
+// resource. Only these errors are reported as terminal failures: a rejected
+// create request is wrong as a whole, while other requests may also fail
+// because of the current state of the resource, e.g. a locked server.
+type createError struct {
+	err error
+}
+
+func (e *createError) Error() string {
+	return e.err.Error()
+}
+
+// Cause returns the wrapped error, so that it can be classified.
+func (e *createError) Cause() error {
+	return e.err
+}
+
+func isCreateError(err error) bool {
+	for err != nil {
+		if _, ok := err.(*createError); ok {
+			return true
+		}
+
+		c, ok := err.(interface{ Cause() error })
+		if !ok {
+			return false
+		}
+		err = c.Cause()
+	}
+
+	return false
+}
@@ -0,0 +1,130 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	infrav1alpha2 "github.com/yukirii/cluster-api-provider-vultr/api/v1alpha2"
+)
+
+var (
+	serversCreatedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "capv_servers_created_total",
+			Help: "Total number of Vultr servers created.",
+		},
+	)
+
+	serversDeletedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "capv_servers_deleted_total",
+			Help: "Total number of Vultr servers deleted.",
+		},
+	)
+
+	machineReadySeconds = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "capv_vultrmachine_ready_seconds",
+			Help:    "Time from the creation of a VultrMachine until it is ready.",
+			Buckets: prometheus.ExponentialBuckets(30, 2, 8),
+		},
+	)
+
+	reservedIPsDesc = prometheus.NewDesc(
+		"capv_reserved_ips",
+		"Number of Vultr reserved IPs held by VultrClusters.",
+		nil, nil,
+	)
+
+	machinesDesc = prometheus.NewDesc(
+		"capv_vultrmachines",
+		"Number of VultrMachines by subscription status and server state.",
+		[]string{"subscription_status", "server_state"}, nil,
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		serversCreatedTotal,
+		serversDeletedTotal,
+		machineReadySeconds,
+	)
+}
+
+// MetricsCollector is a prometheus.Collector exposing gauges computed from
+// the VultrClusters and VultrMachines of the management cluster.
+type MetricsCollector struct {
+	client.Client
+	Log logr.Logger
+
+	// WatchFilterValue restricts the gauges to the objects labelled with it.
+	WatchFilterValue string
+}
+
+// Describe implements prometheus.Collector.
+func (c *MetricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- reservedIPsDesc
+	ch <- machinesDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *MetricsCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx := context.Background()
+
+	vultrClusters := &infrav1alpha2.VultrClusterList{}
+	if err := c.List(ctx, vultrClusters, filterListOptions(c.WatchFilterValue)...); err != nil {
+		c.Log.Error(err, "failed to list VultrClusters")
+	} else {
+		reservedIPs := 0
+		for _, vc := range vultrClusters.Items {
+			reservedIPs += len(vc.Status.APIEndpoints)
+		}
+		ch <- prometheus.MustNewConstMetric(reservedIPsDesc, prometheus.GaugeValue, float64(reservedIPs))
+	}
+
+	vultrMachines := &infrav1alpha2.VultrMachineList{}
+	if err := c.List(ctx, vultrMachines, filterListOptions(c.WatchFilterValue)...); err != nil {
+		c.Log.Error(err, "failed to list VultrMachines")
+		return
+	}
+
+	type key struct {
+		subscriptionStatus string
+		serverState        string
+	}
+	counts := map[key]int{}
+	for _, vm := range vultrMachines.Items {
+		k := key{subscriptionStatus: "unknown", serverState: "unknown"}
+		if vm.Status.SubscriptionStatus != nil {
+			k.subscriptionStatus = string(*vm.Status.SubscriptionStatus)
+		}
+		if vm.Status.ServerState != nil {
+			k.serverState = string(*vm.Status.ServerState)
+		}
+		counts[k]++
+	}
+
+	for k, n := range counts {
+		ch <- prometheus.MustNewConstMetric(machinesDesc, prometheus.GaugeValue, float64(n),
+			k.subscriptionStatus, k.serverState)
+	}
+}
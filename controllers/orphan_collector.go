@@ -0,0 +1,314 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	vultr "github.com/JamesClonk/vultr/lib"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/cluster-api/controllers/noderefutil"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1alpha2 "github.com/yukirii/cluster-api-provider-vultr/api/v1alpha2"
+	"github.com/yukirii/cluster-api-provider-vultr/pkg/cloud/scope"
+	"github.com/yukirii/cluster-api-provider-vultr/pkg/cloud/tags"
+	"github.com/yukirii/cluster-api-provider-vultr/pkg/cloud/vultrclient"
+)
+
+// OrphanCollector periodically looks for Vultr resources created by the provider
+// for the VultrClusters of the management cluster which are no longer referenced
+// by any VultrMachine or VultrCluster, e.g. because the controller crashed before
+// the object status was patched.
+type OrphanCollector struct {
+	client.Client
+	Log          logr.Logger
+	VultrClients *vultrclient.Pool
+
+	// Interval is the period between two collections.
+	Interval time.Duration
+
+	// GracePeriod is how long a resource must stay orphaned before it is reported.
+	GracePeriod time.Duration
+
+	// Delete enables deletion of the reported orphans, except the ones with
+	// legacy tags or labels, which are only reported.
+	Delete bool
+
+	// WatchFilterValue restricts collection to the VultrClusters labelled with it.
+	WatchFilterValue string
+
+	// orphans holds the time each orphaned resource was first seen.
+	orphans map[string]time.Time
+}
+
+// Start runs the collector until the stop channel is closed.
+func (c *OrphanCollector) Start(stop <-chan struct{}) error {
+	c.orphans = map[string]time.Time{}
+
+	wait.Until(func() {
+		if err := c.collect(context.Background()); err != nil {
+			c.Log.Error(err, "failed to collect orphaned resources")
+		}
+	}, c.Interval, stop)
+
+	return nil
+}
+
+// references holds the Vultr resources referred to by the provider objects.
+type references struct {
+	serverIDs     map[string]bool
+	machines      map[string]bool
+	reservedIPIDs map[string]bool
+}
+
+// machineKey returns the key of a VultrMachine in references.machines.
+func machineKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+func (c *OrphanCollector) collect(ctx context.Context) error {
+	vultrClusters := &infrav1alpha2.VultrClusterList{}
+	if err := c.List(ctx, vultrClusters, filterListOptions(c.WatchFilterValue)...); err != nil {
+		return errors.Wrap(err, "failed to list VultrClusters")
+	}
+
+	// VultrMachines are not filtered, so that one missing the watch filter
+	// label never makes its server look orphaned.
+	vultrMachines := &infrav1alpha2.VultrMachineList{}
+	if err := c.List(ctx, vultrMachines); err != nil {
+		return errors.Wrap(err, "failed to list VultrMachines")
+	}
+
+	// Collect everything the provider objects still refer to.
+	refs := references{
+		serverIDs:     map[string]bool{},
+		machines:      map[string]bool{},
+		reservedIPIDs: map[string]bool{},
+	}
+	for _, vc := range vultrClusters.Items {
+		refs.reservedIPIDs[vc.Spec.ReservedIPID] = true
+		refs.reservedIPIDs[vc.Spec.ReservedIPv6ID] = true
+		for _, e := range vc.Status.APIEndpoints {
+			refs.reservedIPIDs[e.ID] = true
+		}
+	}
+
+	for _, vm := range vultrMachines.Items {
+		// Servers are only known by their tags until the ProviderID is recorded.
+		refs.machines[machineKey(vm.Namespace, vm.Name)] = true
+		if vm.Spec.ProviderID == nil {
+			continue
+		}
+		pid, err := noderefutil.NewProviderID(*vm.Spec.ProviderID)
+		if err != nil {
+			continue
+		}
+		refs.serverIDs[pid.ID()] = true
+	}
+
+	seen := map[string]bool{}
+	for apiKey, clusters := range c.accounts(ctx, vultrClusters.Items) {
+		if err := c.collectAccount(c.VultrClients.Get(apiKey), clusters, refs, seen); err != nil {
+			c.Log.Error(err, "failed to collect orphaned resources")
+		}
+	}
+
+	// Forget resources which are not orphaned anymore.
+	for key := range c.orphans {
+		if !seen[key] {
+			delete(c.orphans, key)
+		}
+	}
+
+	return nil
+}
+
+// accounts groups the clusters by API key. Only the resources of clusters managed
+// here are looked at, so that resources of clusters which have been moved to another
+// management cluster, or are being moved, are never collected.
+func (c *OrphanCollector) accounts(ctx context.Context, vultrClusters []infrav1alpha2.VultrCluster) map[string][]*infrav1alpha2.VultrCluster {
+	accounts := map[string][]*infrav1alpha2.VultrCluster{}
+	for i := range vultrClusters {
+		vc := &vultrClusters[i]
+
+		cluster, err := util.GetOwnerCluster(ctx, c.Client, vc.ObjectMeta)
+		if err != nil || cluster == nil || isPaused(cluster, vc) {
+			continue
+		}
+
+		apiKey, err := scope.APIKey(ctx, c.Client, vc)
+		if err != nil {
+			c.Log.Error(err, "failed to get API key", "vultrcluster", vc.Name)
+			continue
+		}
+
+		accounts[apiKey] = append(accounts[apiKey], vc)
+	}
+
+	return accounts
+}
+
+// collectAccount reports or deletes the orphaned resources of the clusters of a Vultr account.
+func (c *OrphanCollector) collectAccount(vultrClient *vultr.Client, clusters []*infrav1alpha2.VultrCluster, refs references, seen map[string]bool) error {
+	servers, err := vultrClient.GetServers()
+	if err != nil {
+		return errors.Wrap(err, "failed to list servers")
+	}
+
+	bareMetalServers, err := vultrClient.GetBareMetalServers()
+	if err != nil {
+		return errors.Wrap(err, "failed to list bare metal servers")
+	}
+
+	bareMetal := map[string]bool{}
+	for _, b := range bareMetalServers {
+		bareMetal[b.ID] = true
+		servers = append(servers, serverFromBareMetal(b))
+	}
+
+	for _, s := range servers {
+		if ownerOfServer(clusters, s.Tag) == nil {
+			continue
+		}
+
+		t := tags.Parse(s.Tag)
+		if refs.serverIDs[s.ID] || refs.machines[machineKey(t[tags.NamespaceKey], t[tags.MachineKey])] {
+			continue
+		}
+
+		key := "server/" + s.ID
+		if bareMetal[s.ID] {
+			key = "baremetal/" + s.ID
+		}
+		seen[key] = true
+		if !c.expired(key) {
+			continue
+		}
+
+		// Legacy tags only hold the cluster name, so the server may belong to a
+		// same-named cluster of another management cluster: it is never deleted.
+		log := c.Log.WithValues("serverID", s.ID, "label", s.Name, "tag", s.Tag)
+		if !c.Delete || t.IsLegacy() {
+			log.Info("Found orphaned server", "legacy", t.IsLegacy())
+			continue
+		}
+
+		// Fetch the server again, as the list may be cached.
+		tag, err := serverTag(vultrClient, s.ID, bareMetal[s.ID])
+		if err != nil {
+			log.Error(err, "failed to get orphaned server")
+			continue
+		}
+		if ownerOfServer(clusters, tag) == nil {
+			log.Info("Orphaned server is no longer owned by a cluster, not deleting it", "tag", tag)
+			continue
+		}
+
+		log.Info("Deleting orphaned server", "bareMetal", bareMetal[s.ID])
+		deleteServer := vultrClient.DeleteServer
+		if bareMetal[s.ID] {
+			deleteServer = vultrClient.DeleteBareMetalServer
+		}
+		if err := deleteServer(s.ID); err != nil {
+			log.Error(err, "failed to delete orphaned server")
+			continue
+		}
+		serversDeletedTotal.Inc()
+	}
+
+	ips, err := vultrClient.ListReservedIP()
+	if err != nil {
+		return errors.Wrap(err, "failed to list reserved IPs")
+	}
+
+	for _, ip := range ips {
+		owner := ownerOfReservedIP(clusters, ip.Label)
+		if owner == nil || refs.reservedIPIDs[ip.ID] {
+			continue
+		}
+
+		key := "reservedip/" + ip.ID
+		seen[key] = true
+		if !c.expired(key) {
+			continue
+		}
+
+		// Like legacy server tags, legacy labels only hold the cluster name.
+		legacy := ip.Label == owner.Name
+		log := c.Log.WithValues("reservedIPID", ip.ID, "subnet", ip.Subnet, "label", ip.Label)
+		if !c.Delete || legacy || ip.AttachedTo != "" {
+			log.Info("Found orphaned reserved IP", "legacy", legacy, "attachedTo", ip.AttachedTo)
+			continue
+		}
+
+		log.Info("Deleting orphaned reserved IP")
+		if err := vultrClient.DestroyReservedIP(ip.ID); err != nil {
+			log.Error(err, "failed to destroy orphaned reserved IP")
+		}
+	}
+
+	return nil
+}
+
+// serverTag returns the current tag of the server.
+func serverTag(vultrClient *vultr.Client, id string, bareMetal bool) (string, error) {
+	if bareMetal {
+		b, err := vultrClient.GetBareMetalServer(id)
+		return b.Tag, err
+	}
+
+	s, err := vultrClient.GetServer(id)
+	return s.Tag, err
+}
+
+// ownerOfServer returns the cluster owning the server with the tag, if any.
+func ownerOfServer(clusters []*infrav1alpha2.VultrCluster, tag string) *infrav1alpha2.VultrCluster {
+	t := tags.Parse(tag)
+	for _, vc := range clusters {
+		if t.IsOwnedBy(vc.Namespace, vc.Name, vc.OwnerID()) {
+			return vc
+		}
+	}
+
+	return nil
+}
+
+// ownerOfReservedIP returns the cluster owning the reserved IP with the label, if any.
+func ownerOfReservedIP(clusters []*infrav1alpha2.VultrCluster, label string) *infrav1alpha2.VultrCluster {
+	for _, vc := range clusters {
+		if ownsReservedIP(vc, label) {
+			return vc
+		}
+	}
+
+	return nil
+}
+
+// expired returns true if the resource has been orphaned longer than the grace period.
+func (c *OrphanCollector) expired(key string) bool {
+	firstSeen, ok := c.orphans[key]
+	if !ok {
+		c.orphans[key] = time.Now()
+		return c.GracePeriod <= 0
+	}
+
+	return time.Since(firstSeen) >= c.GracePeriod
+}
@@ -0,0 +1,368 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	vultr "github.com/JamesClonk/vultr/lib"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	infrav1alpha2 "github.com/yukirii/cluster-api-provider-vultr/api/v1alpha2"
+	"github.com/yukirii/cluster-api-provider-vultr/pkg/cloud/tags"
+)
+
+// fakeVultrAPI serves the list endpoints of the Vultr API from its resources,
+// keyed by SUBID, and records the POST requests it receives.
+type fakeVultrAPI struct {
+	servers     map[string]map[string]string
+	bareMetal   map[string]map[string]string
+	reservedIPs map[string]map[string]string
+
+	// posts holds "<endpoint> <SUBID>" for each POST request.
+	posts []string
+}
+
+func (f *fakeVultrAPI) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodPost {
+		if err := req.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.posts = append(f.posts, req.URL.Path[len("/v1/"):]+" "+req.PostForm.Get("SUBID"))
+		return
+	}
+
+	var resources map[string]map[string]string
+	switch req.URL.Path {
+	case "/v1/server/list":
+		resources = f.servers
+	case "/v1/baremetal/list":
+		resources = f.bareMetal
+	case "/v1/reservedip/list":
+		resources = f.reservedIPs
+	default:
+		http.NotFound(w, req)
+		return
+	}
+
+	var body interface{} = resources
+	if id := req.URL.Query().Get("SUBID"); id != "" {
+		r, ok := resources[id]
+		if !ok {
+			http.Error(w, "Invalid server.", http.StatusPreconditionFailed)
+			return
+		}
+		body = r
+	}
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// newFakeVultrClient returns a client of the fake API served at url.
+func newFakeVultrClient(url string) *vultr.Client {
+	return vultr.NewClient("key", &vultr.Options{
+		Endpoint:       url + "/",
+		RateLimitation: time.Nanosecond,
+	})
+}
+
+// newTestVultrCluster returns a VultrCluster in the default namespace.
+func newTestVultrCluster(name, uid string) *infrav1alpha2.VultrCluster {
+	return &infrav1alpha2.VultrCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			UID:       types.UID(uid),
+		},
+	}
+}
+
+// machineTag returns the tag of the server of a machine of the VultrCluster.
+func machineTag(vultrCluster *infrav1alpha2.VultrCluster, machine string) string {
+	return tags.Tags{
+		tags.ClusterKey:    vultrCluster.Name,
+		tags.ClusterUIDKey: vultrCluster.OwnerID(),
+		tags.NamespaceKey:  vultrCluster.Namespace,
+		tags.RoleKey:       tags.NodeRole,
+		tags.MachineKey:    machine,
+	}.String()
+}
+
+func TestCollectAccount(t *testing.T) {
+	owner := newTestVultrCluster("capi", "uid-1")
+	sameName := newTestVultrCluster("capi", "uid-2")
+	// Paused clusters and clusters of other management clusters are not
+	// passed to collectAccount, like this one (see TestAccounts).
+	other := newTestVultrCluster("other", "uid-3")
+
+	tests := []struct {
+		name        string
+		api         fakeVultrAPI
+		refs        references
+		gracePeriod time.Duration
+		noDelete    bool
+		wantPosts   []string
+	}{
+		{
+			name: "server referenced by ProviderID",
+			api: fakeVultrAPI{servers: map[string]map[string]string{
+				"1": {"SUBID": "1", "tag": machineTag(owner, "gone")},
+			}},
+			refs: references{serverIDs: map[string]bool{"1": true}},
+		},
+		{
+			name: "server referenced by machine tag",
+			api: fakeVultrAPI{servers: map[string]map[string]string{
+				"1": {"SUBID": "1", "tag": machineTag(owner, "m1")},
+			}},
+			refs: references{machines: map[string]bool{machineKey("default", "m1"): true}},
+		},
+		{
+			name: "orphaned server",
+			api: fakeVultrAPI{servers: map[string]map[string]string{
+				"1": {"SUBID": "1", "tag": machineTag(owner, "gone")},
+			}},
+			wantPosts: []string{"server/destroy 1"},
+		},
+		{
+			name: "orphaned bare metal server",
+			api: fakeVultrAPI{bareMetal: map[string]map[string]string{
+				"2": {"SUBID": "2", "tag": machineTag(owner, "gone")},
+			}},
+			wantPosts: []string{"baremetal/destroy 2"},
+		},
+		{
+			name: "orphaned server with deletion disabled",
+			api: fakeVultrAPI{servers: map[string]map[string]string{
+				"1": {"SUBID": "1", "tag": machineTag(owner, "gone")},
+			}},
+			noDelete: true,
+		},
+		{
+			name: "orphaned server within the grace period",
+			api: fakeVultrAPI{servers: map[string]map[string]string{
+				"1": {"SUBID": "1", "tag": machineTag(owner, "gone")},
+			}},
+			gracePeriod: time.Hour,
+		},
+		{
+			name: "legacy-tagged server",
+			api: fakeVultrAPI{servers: map[string]map[string]string{
+				"1": {"SUBID": "1", "tag": "capi:owned"},
+			}},
+		},
+		{
+			name: "server of another cluster",
+			api: fakeVultrAPI{servers: map[string]map[string]string{
+				"1": {"SUBID": "1", "tag": machineTag(other, "gone")},
+				"2": {"SUBID": "2", "tag": machineTag(sameName, "gone")},
+				"3": {"SUBID": "3", "tag": "team=infra"},
+			}},
+		},
+		{
+			name: "orphaned reserved IP",
+			api: fakeVultrAPI{reservedIPs: map[string]map[string]string{
+				"10": {"SUBID": "10", "label": reservedIPLabel(owner)},
+			}},
+			wantPosts: []string{"reservedip/destroy 10"},
+		},
+		{
+			name: "referenced reserved IP",
+			api: fakeVultrAPI{reservedIPs: map[string]map[string]string{
+				"10": {"SUBID": "10", "label": reservedIPLabel(owner)},
+			}},
+			refs: references{reservedIPIDs: map[string]bool{"10": true}},
+		},
+		{
+			name: "attached reserved IP",
+			api: fakeVultrAPI{reservedIPs: map[string]map[string]string{
+				"10": {"SUBID": "10", "label": reservedIPLabel(owner) + ":v6", "attached_SUBID": "5"},
+			}},
+		},
+		{
+			name: "legacy-labelled reserved IP",
+			api: fakeVultrAPI{reservedIPs: map[string]map[string]string{
+				"10": {"SUBID": "10", "label": "capi"},
+			}},
+		},
+		{
+			name: "reserved IP of another cluster",
+			api: fakeVultrAPI{reservedIPs: map[string]map[string]string{
+				"10": {"SUBID": "10", "label": reservedIPLabel(other)},
+				"11": {"SUBID": "11", "label": reservedIPLabel(sameName)},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &OrphanCollector{
+				Log:         logf.NullLogger{},
+				GracePeriod: tt.gracePeriod,
+				Delete:      !tt.noDelete,
+				orphans:     map[string]time.Time{},
+			}
+
+			api := tt.api
+			srv := httptest.NewServer(&api)
+			defer srv.Close()
+
+			err := c.collectAccount(newFakeVultrClient(srv.URL), []*infrav1alpha2.VultrCluster{owner}, tt.refs, map[string]bool{})
+			if err != nil {
+				t.Fatalf("collectAccount() error = %v", err)
+			}
+
+			sort.Strings(api.posts)
+			if !reflect.DeepEqual(api.posts, tt.wantPosts) {
+				t.Errorf("collectAccount() sent %v, want %v", api.posts, tt.wantPosts)
+			}
+		})
+	}
+}
+
+func TestOwnerOfServer(t *testing.T) {
+	owner := newTestVultrCluster("capi", "uid-1")
+	moved := newTestVultrCluster("moved", "uid-2")
+	moved.Annotations = map[string]string{infrav1alpha2.OwnerIDAnnotation: "uid-0"}
+	clusters := []*infrav1alpha2.VultrCluster{owner, moved}
+
+	otherNamespace := newTestVultrCluster("capi", "uid-1")
+	otherNamespace.Namespace = "other"
+
+	tests := []struct {
+		name string
+		tag  string
+		want *infrav1alpha2.VultrCluster
+	}{
+		{"tagged server", machineTag(owner, "m1"), owner},
+		{"server of a moved cluster", machineTag(moved, "m1"), moved},
+		{"legacy tag", "capi:owned", owner},
+		{"same-named cluster with another UID", machineTag(newTestVultrCluster("capi", "uid-3"), "m1"), nil},
+		{"same-named cluster in another namespace", machineTag(otherNamespace, "m1"), nil},
+		{"unknown cluster", machineTag(newTestVultrCluster("other", "uid-1"), "m1"), nil},
+		{"no tag", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ownerOfServer(clusters, tt.tag); got != tt.want {
+				t.Errorf("ownerOfServer(%q) = %v, want %v", tt.tag, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpired(t *testing.T) {
+	tests := []struct {
+		name        string
+		gracePeriod time.Duration
+		firstSeen   time.Duration
+		want        bool
+	}{
+		{"first seen without grace period", 0, 0, true},
+		{"first seen with grace period", time.Hour, 0, false},
+		{"seen within the grace period", time.Hour, time.Minute, false},
+		{"seen past the grace period", time.Hour, 2 * time.Hour, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &OrphanCollector{
+				GracePeriod: tt.gracePeriod,
+				orphans:     map[string]time.Time{},
+			}
+			if tt.firstSeen > 0 {
+				c.orphans["server/1"] = time.Now().Add(-tt.firstSeen)
+			}
+
+			if got := c.expired("server/1"); got != tt.want {
+				t.Errorf("expired() = %v, want %v", got, tt.want)
+			}
+			if _, ok := c.orphans["server/1"]; !ok {
+				t.Errorf("expired() did not record the orphan")
+			}
+		})
+	}
+}
+
+func TestAccounts(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clusterv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := infrav1alpha2.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	newCluster := func(name string, paused bool) *clusterv1.Cluster {
+		cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+		if paused {
+			cluster.Annotations = map[string]string{pausedAnnotation: "true"}
+		}
+		return cluster
+	}
+	newVultrCluster := func(name, owner string, paused bool) infrav1alpha2.VultrCluster {
+		vc := *newTestVultrCluster(name, "uid-"+name)
+		if owner != "" {
+			vc.OwnerReferences = []metav1.OwnerReference{{
+				APIVersion: clusterv1.GroupVersion.String(),
+				Kind:       "Cluster",
+				Name:       owner,
+			}}
+		}
+		if paused {
+			vc.Annotations = map[string]string{pausedAnnotation: "true"}
+		}
+		return vc
+	}
+
+	c := &OrphanCollector{
+		Client: fake.NewFakeClientWithScheme(scheme, newCluster("active", false), newCluster("paused", true)),
+		Log:    logf.NullLogger{},
+	}
+	vultrClusters := []infrav1alpha2.VultrCluster{
+		newVultrCluster("active", "active", false),
+		newVultrCluster("paused-cluster", "paused", false),
+		newVultrCluster("paused-vultrcluster", "active", true),
+		newVultrCluster("no-owner", "", false),
+		newVultrCluster("missing-owner", "missing", false),
+	}
+
+	var got []string
+	for _, clusters := range c.accounts(context.Background(), vultrClusters) {
+		for _, vc := range clusters {
+			got = append(got, vc.Name)
+		}
+	}
+
+	if want := []string{"active"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("accounts() has clusters %v, want %v", got, want)
+	}
+}
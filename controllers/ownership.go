@@ -0,0 +1,88 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	vultr "github.com/JamesClonk/vultr/lib"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	infrav1alpha2 "github.com/yukirii/cluster-api-provider-vultr/api/v1alpha2"
+	"github.com/yukirii/cluster-api-provider-vultr/pkg/cloud/scope"
+	"github.com/yukirii/cluster-api-provider-vultr/pkg/cloud/tags"
+)
+
+// ownershipError is returned when a Vultr resource is not owned by the object
+// being reconciled, so that it must not be acted on.
+type ownershipError struct {
+	message string
+}
+
+func (e *ownershipError) Error() string {
+	return e.message
+}
+
+func isOwnershipError(err error) bool {
+	_, ok := err.(*ownershipError)
+	return ok
+}
+
+// verifyServerOwnership returns an ownershipError if the server is not the one
+// of the VultrMachine. Servers with legacy tags are only checked against the cluster.
+func verifyServerOwnership(machineScope *scope.MachineScope, server *vultr.Server) error {
+	if !machineScope.OwnsServer(server) {
+		return &ownershipError{fmt.Sprintf("server %q is not owned by VultrCluster %s/%s (tag %q)",
+			server.ID, machineScope.VultrCluster.Namespace, machineScope.VultrCluster.Name, server.Tag)}
+	}
+
+	if t := tags.Parse(server.Tag); !t.IsLegacy() && t[tags.MachineKey] != machineScope.VultrMachine.Name {
+		return &ownershipError{fmt.Sprintf("server %q belongs to machine %q, not %q",
+			server.ID, t[tags.MachineKey], machineScope.VultrMachine.Name)}
+	}
+
+	return nil
+}
+
+// ownsReservedIP returns true if the reserved IP label identifies it as a
+// reserved IP of the VultrCluster. Reserved IPs created before they were
+// labelled with the owner ID are labelled with the cluster name only.
+func ownsReservedIP(vultrCluster *infrav1alpha2.VultrCluster, label string) bool {
+	l := reservedIPLabel(vultrCluster)
+	return label == l || strings.HasPrefix(label, l+":") || label == vultrCluster.Name
+}
+
+// isRetained returns true if any of the objects has the retain annotation.
+func isRetained(objs ...metav1.Object) bool {
+	for _, o := range objs {
+		if _, ok := o.GetAnnotations()[infrav1alpha2.RetainAnnotation]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// disownedTag returns the tag of the server without the tags identifying its owner.
+func disownedTag(tag string) string {
+	t := tags.Parse(tag)
+	for _, k := range []string{tags.ClusterKey, tags.ClusterUIDKey, tags.NamespaceKey, tags.RoleKey, tags.MachineKey} {
+		delete(t, k)
+	}
+
+	return t.String()
+}
@@ -0,0 +1,119 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	vultr "github.com/JamesClonk/vultr/lib"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+
+	infrav1alpha2 "github.com/yukirii/cluster-api-provider-vultr/api/v1alpha2"
+	"github.com/yukirii/cluster-api-provider-vultr/pkg/cloud/scope"
+)
+
+// newTestMachineScope returns the scope of the machine of the VultrCluster.
+func newTestMachineScope(vultrCluster *infrav1alpha2.VultrCluster, machine string) *scope.MachineScope {
+	meta := metav1.ObjectMeta{Name: machine, Namespace: vultrCluster.Namespace}
+
+	return &scope.MachineScope{
+		Machine:      &clusterv1.Machine{ObjectMeta: meta},
+		VultrMachine: &infrav1alpha2.VultrMachine{ObjectMeta: meta},
+		VultrCluster: vultrCluster,
+	}
+}
+
+func TestVerifyServerOwnership(t *testing.T) {
+	owner := newTestVultrCluster("capi", "uid-1")
+	otherNamespace := newTestVultrCluster("capi", "uid-1")
+	otherNamespace.Namespace = "other"
+
+	tests := []struct {
+		name    string
+		tag     string
+		wantErr bool
+	}{
+		{"server of the machine", machineTag(owner, "m1"), false},
+		{"server of another machine", machineTag(owner, "m2"), true},
+		{"same-named cluster with another UID", machineTag(newTestVultrCluster("capi", "uid-2"), "m1"), true},
+		{"same-named cluster in another namespace", machineTag(otherNamespace, "m1"), true},
+		{"legacy tag", "capi:owned", false},
+		{"legacy tag of another cluster", "other:owned", true},
+		{"no tag", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyServerOwnership(newTestMachineScope(owner, "m1"), &vultr.Server{ID: "1", Tag: tt.tag})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifyServerOwnership() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !isOwnershipError(err) {
+				t.Errorf("verifyServerOwnership() error = %v, want an ownershipError", err)
+			}
+		})
+	}
+}
+
+func TestOwnsReservedIP(t *testing.T) {
+	owner := newTestVultrCluster("capi", "uid-1")
+
+	tests := []struct {
+		name  string
+		label string
+		want  bool
+	}{
+		{"IPv4 reserved IP", "capi:uid-1", true},
+		{"IPv6 reserved IP", "capi:uid-1:v6", true},
+		{"legacy label", "capi", true},
+		{"same-named cluster with another UID", "capi:uid-2", false},
+		{"owner ID prefix", "capi:uid-10", false},
+		{"another cluster", "other:uid-1", false},
+		{"no label", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ownsReservedIP(owner, tt.label); got != tt.want {
+				t.Errorf("ownsReservedIP(%q) = %v, want %v", tt.label, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDisownedTag(t *testing.T) {
+	owner := newTestVultrCluster("capi", "uid-1")
+
+	tests := []struct {
+		name string
+		tag  string
+		want string
+	}{
+		{"owner tags only", machineTag(owner, "m1"), ""},
+		{"additional tags are kept", machineTag(owner, "m1") + ",team=infra", "team=infra"},
+		{"legacy tag", "capi:owned", ""},
+		{"no tag", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := disownedTag(tt.tag); got != tt.want {
+				t.Errorf("disownedTag(%q) = %q, want %q", tt.tag, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+)
+
+// pausedAnnotation is the annotation that pauses the reconciliation of an object,
+// e.g. while it is being moved by clusterctl. The Cluster API release in use
+// neither exports it nor has Cluster.Spec.Paused, so it is defined here.
+const pausedAnnotation = "cluster.x-k8s.io/paused"
+
+// isPaused returns true if the Cluster or the object has the paused annotation.
+func isPaused(cluster *clusterv1.Cluster, o metav1.Object) bool {
+	if cluster != nil && hasPausedAnnotation(cluster) {
+		return true
+	}
+
+	return hasPausedAnnotation(o)
+}
+
+func hasPausedAnnotation(o metav1.Object) bool {
+	_, ok := o.GetAnnotations()[pausedAnnotation]
+	return ok
+}
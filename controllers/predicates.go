@@ -0,0 +1,64 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// WatchLabel is the label selecting the objects reconciled by a manager run
+// with a watch filter, so that several managers can run side by side.
+const WatchLabel = "cluster.x-k8s.io/watch-filter"
+
+// resourceHasFilterLabel returns a predicate accepting only the objects labelled
+// with the watch filter value. All objects are accepted if the value is empty.
+func resourceHasFilterLabel(labelValue string) predicate.Funcs {
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return hasFilterLabel(e.Meta, labelValue)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return hasFilterLabel(e.MetaNew, labelValue)
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return hasFilterLabel(e.Meta, labelValue)
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return hasFilterLabel(e.Meta, labelValue)
+		},
+	}
+}
+
+func hasFilterLabel(o metav1.Object, labelValue string) bool {
+	if labelValue == "" {
+		return true
+	}
+
+	return o.GetLabels()[WatchLabel] == labelValue
+}
+
+// filterListOptions returns the options listing only the objects labelled
+// with the watch filter value.
+func filterListOptions(labelValue string) []client.ListOption {
+	if labelValue == "" {
+		return nil
+	}
+
+	return []client.ListOption{client.MatchingLabels{WatchLabel: labelValue}}
+}
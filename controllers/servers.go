@@ -0,0 +1,160 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+
+	vultr "github.com/JamesClonk/vultr/lib"
+
+	"github.com/yukirii/cluster-api-provider-vultr/pkg/cloud/scope"
+)
+
+// Bare metal servers are managed with a separate Vultr API. The helpers below
+// call the API matching the instance class of the VultrMachine, and represent
+// bare metal servers as vultr.Server so that the reconciler handles both alike.
+
+// providerID returns the ProviderID of the server. Bare metal servers have
+// their own format, as their ids are not valid for the server API.
+func providerID(machineScope *scope.MachineScope, id string) string {
+	if machineScope.IsBareMetal() {
+		return fmt.Sprintf("vultr:////baremetal/%s", id)
+	}
+
+	return fmt.Sprintf("vultr:////%s", id)
+}
+
+func getServer(machineScope *scope.MachineScope, id string) (vultr.Server, error) {
+	if !machineScope.IsBareMetal() {
+		return machineScope.VultrClient.GetServer(id)
+	}
+
+	b, err := machineScope.VultrClient.GetBareMetalServer(id)
+	if err != nil {
+		return vultr.Server{}, err
+	}
+
+	return serverFromBareMetal(b), nil
+}
+
+func listServers(machineScope *scope.MachineScope) ([]vultr.Server, error) {
+	if !machineScope.IsBareMetal() {
+		return machineScope.VultrClient.GetServers()
+	}
+
+	bs, err := machineScope.VultrClient.GetBareMetalServers()
+	if err != nil {
+		return nil, err
+	}
+
+	servers := make([]vultr.Server, 0, len(bs))
+	for _, b := range bs {
+		servers = append(servers, serverFromBareMetal(b))
+	}
+
+	return servers, nil
+}
+
+// createServer creates the server with the client, which may send parameters
+// the library does not support.
+func createServer(machineScope *scope.MachineScope, vultrClient *vultr.Client, name string, region int, options *vultr.ServerOptions) (vultr.Server, error) {
+	spec := machineScope.VultrMachine.Spec
+	if !machineScope.IsBareMetal() {
+		return vultrClient.CreateServer(name, region, spec.PlanID, spec.OSID, options)
+	}
+
+	b, err := vultrClient.CreateBareMetalServer(name, region, spec.PlanID, spec.OSID, &vultr.BareMetalServerOptions{
+		Script:               options.Script,
+		UserData:             options.UserData,
+		Snapshot:             options.Snapshot,
+		SSHKey:               options.SSHKey,
+		IPV6:                 options.IPV6,
+		DontNotifyOnActivate: options.DontNotifyOnActivate,
+		Hostname:             options.Hostname,
+		Tag:                  options.Tag,
+		AppID:                options.AppID,
+	})
+	if err != nil {
+		return vultr.Server{}, err
+	}
+
+	return serverFromBareMetal(b), nil
+}
+
+func tagServer(machineScope *scope.MachineScope, id, tag string) error {
+	if machineScope.IsBareMetal() {
+		return machineScope.VultrClient.TagBareMetalServer(id, tag)
+	}
+
+	return machineScope.VultrClient.TagServer(id, tag)
+}
+
+func deleteServer(machineScope *scope.MachineScope, id string) error {
+	if machineScope.IsBareMetal() {
+		return machineScope.VultrClient.DeleteBareMetalServer(id)
+	}
+
+	return machineScope.VultrClient.DeleteServer(id)
+}
+
+func reinstallServer(machineScope *scope.MachineScope, id string) error {
+	if machineScope.IsBareMetal() {
+		return machineScope.VultrClient.ReinstallBareMetalServer(id)
+	}
+
+	return machineScope.VultrClient.ReinstallServer(id)
+}
+
+func rebootServer(machineScope *scope.MachineScope, id string) error {
+	if machineScope.IsBareMetal() {
+		return machineScope.VultrClient.RebootBareMetalServer(id)
+	}
+
+	return machineScope.VultrClient.RebootServer(id)
+}
+
+func haltServer(machineScope *scope.MachineScope, id string) error {
+	if machineScope.IsBareMetal() {
+		return machineScope.VultrClient.HaltBareMetalServer(id)
+	}
+
+	return machineScope.VultrClient.HaltServer(id)
+}
+
+// serverFromBareMetal returns the bare metal server as a vultr.Server.
+// Bare metal servers have neither power status nor server state.
+func serverFromBareMetal(b vultr.BareMetalServer) vultr.Server {
+	return vultr.Server{
+		ID:         b.ID,
+		Name:       b.Name,
+		OS:         b.OS,
+		RAM:        b.RAM,
+		Disk:       b.Disk,
+		MainIP:     b.MainIP,
+		VCpus:      b.CPUs,
+		Location:   b.Location,
+		RegionID:   b.RegionID,
+		Created:    b.Created,
+		Status:     b.Status,
+		NetmaskV4:  b.NetmaskV4,
+		GatewayV4:  b.GatewayV4,
+		PlanID:     b.PlanID,
+		V6Networks: b.V6Networks,
+		Tag:        b.Tag,
+		OSID:       b.OSID,
+		AppID:      b.AppID,
+	}
+}
@@ -17,31 +17,49 @@ package controllers
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
 	vultr "github.com/JamesClonk/vultr/lib"
 	"github.com/go-logr/logr"
 	"github.com/labstack/gommon/log"
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	capierrors "sigs.k8s.io/cluster-api/errors"
 	"sigs.k8s.io/cluster-api/util"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	infrav1alpha2 "github.com/yukirii/cluster-api-provider-vultr/api/v1alpha2"
 	"github.com/yukirii/cluster-api-provider-vultr/pkg/cloud/scope"
+	"github.com/yukirii/cluster-api-provider-vultr/pkg/cloud/vultrclient"
+	"github.com/yukirii/cluster-api-provider-vultr/pkg/cloud/vultrerrors"
 )
 
 // VultrClusterReconciler reconciles a VultrCluster object
 type VultrClusterReconciler struct {
 	client.Client
-	Log      logr.Logger
-	Recorder record.EventRecorder
+	Log          logr.Logger
+	Recorder     record.EventRecorder
+	VultrClients *vultrclient.Pool
+
+	// WatchFilterValue restricts reconciliation to the objects labelled with it.
+	WatchFilterValue string
 }
 
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vultrclusters,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vultrclusters/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters;clusters/status,verbs=get;list;watch
+// +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machines,verbs=get;list;watch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vultrmachines,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=events,verbs=get;list;watch;create;update;patch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;update;patch
 
 func (r *VultrClusterReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, reterr error) {
 	ctx := context.Background()
@@ -57,9 +75,30 @@ func (r *VultrClusterReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, ret
 		return ctrl.Result{}, err
 	}
 
+	// Fetch the Cluster. It is not required to delete the VultrCluster.
+	cluster, err := util.GetOwnerCluster(ctx, r.Client, vultrCluster.ObjectMeta)
+	if err != nil && (!apierrors.IsNotFound(err) || vultrCluster.ObjectMeta.DeletionTimestamp.IsZero()) {
+		return ctrl.Result{}, err
+	}
+	if cluster == nil && vultrCluster.ObjectMeta.DeletionTimestamp.IsZero() {
+		log.Info("Cluster Controller has not yet set OwnerRef")
+		return ctrl.Result{}, nil
+	}
+
+	if cluster != nil {
+		log = log.WithValues("cluster", cluster.Name)
+	}
+
+	if isPaused(cluster, vultrCluster) {
+		log.Info("VultrCluster or linked Cluster is marked as paused. Won't reconcile")
+		return ctrl.Result{}, nil
+	}
+
 	clusterScope, err := scope.NewClusterScope(scope.ClusterScopeParams{
 		Client:       r.Client,
+		VultrClients: r.VultrClients,
 		Logger:       log,
+		Cluster:      cluster,
 		VultrCluster: vultrCluster,
 	})
 	if err != nil {
@@ -73,19 +112,89 @@ func (r *VultrClusterReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, ret
 		}
 	}()
 
+	var result ctrl.Result
 	if !vultrCluster.ObjectMeta.DeletionTimestamp.IsZero() {
-		return r.reconcileClusterDelete(clusterScope)
+		result, err = r.reconcileClusterDelete(clusterScope)
+	} else {
+		result, err = r.reconcileCluster(clusterScope)
+	}
+	if err != nil {
+		return r.handleVultrError(clusterScope, err)
+	}
+
+	return result, nil
+}
+
+// handleVultrError decides how to proceed with an error returned by the Vultr API.
+// Transient errors are retried later, and configuration or quota errors are
+// reported as terminal failures of the VultrCluster.
+func (r *VultrClusterReconciler) handleVultrError(clusterScope *scope.ClusterScope, err error) (ctrl.Result, error) {
+	reason := vultrerrors.ReasonForError(err)
+	if reason == vultrerrors.ReasonUnknown {
+		return ctrl.Result{}, err
+	}
+
+	r.Recorder.Eventf(clusterScope.VultrCluster, corev1.EventTypeWarning, string(reason), "Vultr API error: %v", err)
+
+	switch {
+	case reason == vultrerrors.ReasonRateLimited, reason == vultrerrors.ReasonTransient:
+		clusterScope.Logger.Info("Vultr API is unavailable, requeueing", "reason", reason, "error", err.Error())
+		return ctrl.Result{RequeueAfter: vultrErrorRequeueAfter}, nil
+	case reason == vultrerrors.ReasonInvalidArgument && isCreateError(err):
+		clusterScope.SetErrorReason(capierrors.InvalidConfigurationClusterError)
+		clusterScope.SetErrorMessage(err)
+		return ctrl.Result{}, nil
+	case reason == vultrerrors.ReasonQuotaExceeded && isCreateError(err):
+		clusterScope.SetErrorReason(capierrors.CreateClusterError)
+		clusterScope.SetErrorMessage(err)
+		return ctrl.Result{}, nil
 	}
 
-	return r.reconcileCluster(clusterScope)
+	return ctrl.Result{}, err
 }
 
 func (r *VultrClusterReconciler) reconcileClusterDelete(clusterScope *scope.ClusterScope) (ctrl.Result, error) {
 	log.Info("Reconciling Cluster Delete")
 
+	// Control-plane servers may still hold the reserved IP, so wait for the
+	// VultrMachines of the cluster to be deleted before releasing it.
+	remaining, err := r.remainingVultrMachines(clusterScope)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if remaining > 0 {
+		clusterScope.Logger.Info("Waiting for VultrMachines to be deleted", "remaining", remaining)
+		return ctrl.Result{RequeueAfter: deletionRequeueAfter}, nil
+	}
+
+	// The status is lost when the cluster is moved, so the reserved IP recorded in spec is also released.
+	ids := []string{}
+	if clusterScope.VultrCluster.Spec.ReservedIPID != "" {
+		ids = append(ids, clusterScope.VultrCluster.Spec.ReservedIPID)
+	}
+	if clusterScope.VultrCluster.Spec.ReservedIPv6ID != "" {
+		ids = append(ids, clusterScope.VultrCluster.Spec.ReservedIPv6ID)
+	}
 	for _, e := range clusterScope.VultrCluster.Status.APIEndpoints {
-		err := clusterScope.VultrClient.DestroyReservedIP(e.ID)
-		if err != nil {
+		if !util.Contains(ids, e.ID) {
+			ids = append(ids, e.ID)
+		}
+	}
+
+	if isRetained(clusterScope.VultrCluster) {
+		r.Recorder.Eventf(clusterScope.VultrCluster, corev1.EventTypeNormal, "ReservedIPRetained",
+			"Retained reserved IPs %s", strings.Join(ids, ", "))
+		ids = nil
+	}
+
+	for _, id := range ids {
+		if err := r.destroyReservedIP(clusterScope, id); err != nil {
+			if isOwnershipError(err) {
+				r.Recorder.Eventf(clusterScope.VultrCluster, corev1.EventTypeWarning, "DeletionRefused",
+					"Refusing to destroy reserved IP: %v. Set the %s annotation to remove the VultrCluster without destroying it",
+					err, infrav1alpha2.RetainAnnotation)
+				return ctrl.Result{}, nil
+			}
 			return ctrl.Result{}, err
 		}
 	}
@@ -95,6 +204,74 @@ func (r *VultrClusterReconciler) reconcileClusterDelete(clusterScope *scope.Clus
 	return ctrl.Result{}, nil
 }
 
+// remainingVultrMachines returns the number of VultrMachines of the cluster
+// which still exist. Without the Cluster, the Machines of the cluster cannot
+// be reconciled anymore, so they are not waited for.
+func (r *VultrClusterReconciler) remainingVultrMachines(clusterScope *scope.ClusterScope) (int, error) {
+	if clusterScope.Cluster == nil {
+		return 0, nil
+	}
+
+	ctx := context.TODO()
+	machines := &clusterv1.MachineList{}
+	if err := r.List(ctx, machines,
+		client.InNamespace(clusterScope.Cluster.Namespace),
+		client.MatchingLabels{clusterv1.MachineClusterLabelName: clusterScope.Cluster.Name},
+	); err != nil {
+		return 0, errors.Wrap(err, "failed to list Machines")
+	}
+
+	gvk := infrav1alpha2.GroupVersion.WithKind("VultrMachine")
+	remaining := 0
+	for _, m := range machines.Items {
+		if m.Spec.InfrastructureRef.GroupVersionKind() != gvk {
+			continue
+		}
+
+		vultrMachine := &infrav1alpha2.VultrMachine{}
+		key := client.ObjectKey{Namespace: m.Namespace, Name: m.Spec.InfrastructureRef.Name}
+		if err := r.Get(ctx, key, vultrMachine); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return 0, errors.Wrapf(err, "failed to get VultrMachine %q", key)
+		}
+		remaining++
+	}
+
+	return remaining, nil
+}
+
+// destroyReservedIP destroys the reserved IP after fetching it again and
+// verifying that it is labelled as a reserved IP of the VultrCluster.
+func (r *VultrClusterReconciler) destroyReservedIP(clusterScope *scope.ClusterScope, id string) error {
+	ips, err := clusterScope.VultrClient.ListReservedIP()
+	if err != nil {
+		return err
+	}
+
+	for _, ip := range ips {
+		if ip.ID != id {
+			continue
+		}
+
+		if !ownsReservedIP(clusterScope.VultrCluster, ip.Label) {
+			return &ownershipError{fmt.Sprintf("reserved IP %q is not owned by VultrCluster %s/%s (label %q)",
+				ip.ID, clusterScope.VultrCluster.Namespace, clusterScope.VultrCluster.Name, ip.Label)}
+		}
+
+		if err := clusterScope.VultrClient.DestroyReservedIP(id); err != nil {
+			return err
+		}
+		clusterScope.Logger.Info("Destroyed reserved IP", "reservedIPID", id, "subnet", ip.Subnet)
+
+		return nil
+	}
+
+	// The reserved IP is already gone.
+	return nil
+}
+
 func (r *VultrClusterReconciler) reconcileCluster(clusterScope *scope.ClusterScope) (ctrl.Result, error) {
 	log.Info("Reconciling Cluster")
 
@@ -103,50 +280,203 @@ func (r *VultrClusterReconciler) reconcileCluster(clusterScope *scope.ClusterSco
 		clusterScope.VultrCluster.Finalizers = append(clusterScope.VultrCluster.Finalizers, infrav1alpha2.ClusterFinalizer)
 	}
 
-	if len(clusterScope.VultrCluster.Status.APIEndpoints) == 0 {
-		id, err := clusterScope.VultrClient.CreateReservedIP(clusterScope.VultrCluster.Spec.Region, "v4", clusterScope.VultrCluster.Name)
-		if err != nil {
-			return ctrl.Result{}, err
+	// Record the owner ID, so that the resources of the cluster are still
+	// identified as its own once its UID changes on clusterctl move.
+	if _, ok := clusterScope.VultrCluster.Annotations[infrav1alpha2.OwnerIDAnnotation]; !ok {
+		if clusterScope.VultrCluster.Annotations == nil {
+			clusterScope.VultrCluster.Annotations = map[string]string{}
 		}
+		clusterScope.VultrCluster.Annotations[infrav1alpha2.OwnerIDAnnotation] = string(clusterScope.VultrCluster.UID)
+	}
 
-		ip, err := r.findReservedIP(clusterScope.VultrClient, id)
-		if err != nil {
-			return ctrl.Result{}, err
-		}
+	if err := r.reconcileCredentials(clusterScope); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Record the reserved IP of clusters created before it was kept in spec.
+	if clusterScope.VultrCluster.Spec.ReservedIPID == "" && len(clusterScope.VultrCluster.Status.APIEndpoints) > 0 {
+		clusterScope.VultrCluster.Spec.ReservedIPID = clusterScope.VultrCluster.Status.APIEndpoints[0].ID
+	}
+
+	if len(clusterScope.VultrCluster.Status.APIEndpoints) == 0 {
+		endpoints := []infrav1alpha2.APIEndpoint{}
+		for _, spec := range reservedIPSpecs(clusterScope.VultrCluster) {
+			ip, err := r.reconcileReservedIP(clusterScope, spec)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			if !spec.published {
+				continue
+			}
 
-		clusterScope.VultrCluster.Status.APIEndpoints = []infrav1alpha2.APIEndpoint{
-			{
-				ID:   id,
-				Host: ip,
+			host, err := endpointHost(ip)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+
+			endpoints = append(endpoints, infrav1alpha2.APIEndpoint{
+				ID:   ip.ID,
+				Host: host,
 				Port: 6443,
-			},
+			})
 		}
+		clusterScope.VultrCluster.Status.APIEndpoints = endpoints
 	}
 
+	clusterScope.VultrCluster.Status.FailureDomains = clusterScope.VultrCluster.Spec.FailureDomains.DeepCopy()
 	clusterScope.VultrCluster.Status.Ready = true
+	clusterScope.ClearError()
 
 	log.Info("Reconciled Cluster successfully")
 
 	return ctrl.Result{}, nil
 }
 
-func (r *VultrClusterReconciler) findReservedIP(vultrClient *vultr.Client, id string) (string, error) {
+// reservedIPSpec describes a reserved IP used as an API endpoint of the cluster.
+type reservedIPSpec struct {
+	// ipType is the type of the reserved IP, either "v4" or "v6".
+	ipType string
+
+	// label is the label the reserved IP is created with.
+	label string
+
+	// id points to the VultrCluster spec field recording the id of the reserved IP.
+	id *string
+
+	// published is true if the reserved IP is an API endpoint of the cluster.
+	published bool
+}
+
+// reservedIPSpecs returns the reserved IPs of the cluster for its IP family.
+// The first one is the primary API endpoint. The IPv6 reserved IP of DualStack
+// clusters is not published, as no address of it is configured on the servers.
+func reservedIPSpecs(vultrCluster *infrav1alpha2.VultrCluster) []reservedIPSpec {
+	label := reservedIPLabel(vultrCluster)
+
+	switch vultrCluster.Spec.IPFamily {
+	case infrav1alpha2.DualStackIPFamily:
+		return []reservedIPSpec{
+			{ipType: "v4", label: label, id: &vultrCluster.Spec.ReservedIPID, published: true},
+			{ipType: "v6", label: label + ":v6", id: &vultrCluster.Spec.ReservedIPv6ID},
+		}
+	default:
+		return []reservedIPSpec{
+			{ipType: "v4", label: label, id: &vultrCluster.Spec.ReservedIPID, published: true},
+		}
+	}
+}
+
+// reconcileReservedIP returns the reserved IP of the cluster, creating it if needed.
+func (r *VultrClusterReconciler) reconcileReservedIP(clusterScope *scope.ClusterScope, spec reservedIPSpec) (*vultr.IP, error) {
+	// The reserved IP has already been created, e.g. before the cluster was moved.
+	if *spec.id != "" {
+		return r.findReservedIP(clusterScope.VultrClient, *spec.id)
+	}
+
+	// Look for a reserved IP created by a previous reconcile which
+	// didn't manage to record it before creating a new one.
+	ip, err := r.findReservedIPByLabel(clusterScope.VultrClient, spec.label)
+	if err != nil {
+		return nil, err
+	}
+	if ip != nil {
+		*spec.id = ip.ID
+		return ip, nil
+	}
+
+	id, err := clusterScope.VultrClient.CreateReservedIP(clusterScope.VultrCluster.Spec.Region, spec.ipType, spec.label)
+	if err != nil {
+		return nil, &createError{err}
+	}
+	// Record the reserved IP right away, so that it is not lost
+	// if it cannot be fetched yet.
+	*spec.id = id
+
+	return r.findReservedIP(clusterScope.VultrClient, id)
+}
+
+// endpointHost returns the address of the API endpoint on the reserved IP.
+func endpointHost(ip *vultr.IP) (string, error) {
+	if ip.Subnet == "" {
+		return "", errors.Errorf("reserved IP %q has no address", ip.ID)
+	}
+
+	return ip.Subnet, nil
+}
+
+// reconcileCredentials labels the credentials secret so that clusterctl move
+// moves it along with the cluster.
+func (r *VultrClusterReconciler) reconcileCredentials(clusterScope *scope.ClusterScope) error {
+	ref := clusterScope.VultrCluster.Spec.CredentialsSecret
+	if ref == nil {
+		return nil
+	}
+
+	ctx := context.TODO()
+	secret := &corev1.Secret{}
+	key := client.ObjectKey{Namespace: clusterScope.VultrCluster.Namespace, Name: ref.Name}
+	if err := r.Get(ctx, key, secret); err != nil {
+		return errors.Wrapf(err, "failed to get credentials secret %q", key)
+	}
+
+	if _, ok := secret.Labels[infrav1alpha2.ClusterctlMoveLabel]; ok {
+		return nil
+	}
+
+	patch := client.MergeFrom(secret.DeepCopy())
+	if secret.Labels == nil {
+		secret.Labels = map[string]string{}
+	}
+	secret.Labels[infrav1alpha2.ClusterctlMoveLabel] = ""
+
+	return errors.Wrapf(r.Patch(ctx, secret, patch), "failed to label credentials secret %q", key)
+}
+
+func (r *VultrClusterReconciler) findReservedIP(vultrClient *vultr.Client, id string) (*vultr.IP, error) {
 	ips, err := vultrClient.ListReservedIP()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	for _, ip := range ips {
 		if ip.ID == id {
-			return ip.Subnet, nil
+			return &ip, nil
+		}
+	}
+
+	return nil, errors.Errorf("reserved IP %q is not found", id)
+}
+
+func (r *VultrClusterReconciler) findReservedIPByLabel(vultrClient *vultr.Client, label string) (*vultr.IP, error) {
+	ips, err := vultrClient.ListReservedIP()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ip := range ips {
+		if ip.Label == label {
+			return &ip, nil
 		}
 	}
 
-	return "", nil
+	return nil, nil
 }
 
-func (r *VultrClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
+// reservedIPLabel returns the label of the reserved IP used as the API endpoint of the cluster.
+func reservedIPLabel(vultrCluster *infrav1alpha2.VultrCluster) string {
+	return fmt.Sprintf("%s:%s", vultrCluster.Name, vultrCluster.OwnerID())
+}
+
+func (r *VultrClusterReconciler) SetupWithManager(mgr ctrl.Manager, options controller.Options) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&infrav1alpha2.VultrCluster{}).
+		Watches(
+			&source.Kind{Type: &clusterv1.Cluster{}},
+			&handler.EnqueueRequestsFromMapFunc{
+				ToRequests: util.ClusterToInfrastructureMapFunc(infrav1alpha2.GroupVersion.WithKind("VultrCluster")),
+			},
+		).
+		WithOptions(options).
+		WithEventFilter(resourceHasFilterLabel(r.WatchFilterValue)).
 		Complete(r)
 }
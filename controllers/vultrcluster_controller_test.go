@@ -0,0 +1,46 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	vultr "github.com/JamesClonk/vultr/lib"
+)
+
+func TestEndpointHost(t *testing.T) {
+	tests := []struct {
+		name    string
+		ip      vultr.IP
+		want    string
+		wantErr bool
+	}{
+		{"IPv4", vultr.IP{ID: "1", IPType: "v4", Subnet: "192.0.2.10", SubnetSize: 32}, "192.0.2.10", false},
+		{"no address", vultr.IP{ID: "2", IPType: "v4"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := endpointHost(&tt.ip)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("endpointHost() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("endpointHost() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
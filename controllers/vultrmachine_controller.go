@@ -19,33 +19,77 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"net/url"
+	"strconv"
+	"time"
 
 	vultr "github.com/JamesClonk/vultr/lib"
 	"github.com/go-logr/logr"
 	"github.com/labstack/gommon/log"
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
 	"sigs.k8s.io/cluster-api/controllers/noderefutil"
+	capierrors "sigs.k8s.io/cluster-api/errors"
 	"sigs.k8s.io/cluster-api/util"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	infrastructurev1alpha2 "github.com/yukirii/cluster-api-provider-vultr/api/v1alpha2"
 	infrav1alpha2 "github.com/yukirii/cluster-api-provider-vultr/api/v1alpha2"
 	"github.com/yukirii/cluster-api-provider-vultr/pkg/cloud/scope"
+	"github.com/yukirii/cluster-api-provider-vultr/pkg/cloud/tags"
+	"github.com/yukirii/cluster-api-provider-vultr/pkg/cloud/vultrclient"
+	"github.com/yukirii/cluster-api-provider-vultr/pkg/cloud/vultrerrors"
+)
+
+const (
+	// resizingReason is the reason of the Resized condition while the server
+	// is being upgraded.
+	resizingReason = "Resizing"
+
+	// reinstallingReason is the reason of the Reinstalled condition while the
+	// server is being reinstalled.
+	reinstallingReason = "Reinstalling"
+)
+
+const (
+	// vultrErrorRequeueAfter is how long to wait before retrying when the
+	// Vultr API is rate limited or temporarily unavailable.
+	vultrErrorRequeueAfter = 30 * time.Second
+
+	// deletionRequeueAfter is how often to check whether Vultr resources
+	// being deleted are gone.
+	deletionRequeueAfter = 10 * time.Second
+
+	// operationRequeueAfter is how often to check the progress of long-running
+	// server operations, such as snapshots and resizes.
+	operationRequeueAfter = 30 * time.Second
 )
 
 // VultrMachineReconciler reconciles a VultrMachine object
 type VultrMachineReconciler struct {
 	client.Client
-	Log logr.Logger
+	Log          logr.Logger
+	Recorder     record.EventRecorder
+	VultrClients *vultrclient.Pool
+
+	// WatchFilterValue restricts reconciliation to the objects labelled with it.
+	WatchFilterValue string
 }
 
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vultrmachines,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vultrmachines/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machines;machines/status,verbs=get;list;watch
 // +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters;clusters/status,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=events,verbs=get;list;watch;create;update;patch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
 
 func (r *VultrMachineReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, reterr error) {
 	ctx := context.Background()
@@ -82,6 +126,11 @@ func (r *VultrMachineReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, ret
 
 	log = r.Log.WithValues("cluster", cluster.Name)
 
+	if isPaused(cluster, vultrMachine) {
+		log.Info("VultrMachine or linked Cluster is marked as paused. Won't reconcile")
+		return ctrl.Result{}, nil
+	}
+
 	// Fetch the VultrCluster.
 	vultrCluster := &infrav1alpha2.VultrCluster{}
 	vultrClusterName := client.ObjectKey{
@@ -98,6 +147,7 @@ func (r *VultrMachineReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, ret
 	// Create the machine scope
 	machineScope, err := scope.NewMachineScope(scope.MachineScopeParams{
 		Client:       r.Client,
+		VultrClients: r.VultrClients,
 		Logger:       log,
 		Cluster:      cluster,
 		Machine:      machine,
@@ -115,26 +165,82 @@ func (r *VultrMachineReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, ret
 		}
 	}()
 
+	var result ctrl.Result
 	if !vultrMachine.ObjectMeta.DeletionTimestamp.IsZero() {
-		return r.reconcileDelete(machineScope)
+		result, err = r.reconcileDelete(machineScope)
+	} else {
+		result, err = r.reconcileNormal(machineScope)
+	}
+	if err != nil {
+		return r.handleVultrError(machineScope, err)
 	}
 
-	return r.reconcileNormal(machineScope)
+	return result, nil
+}
+
+// handleVultrError decides how to proceed with an error returned by the Vultr API.
+// Transient errors are retried later, and configuration or quota errors
+// rejecting the creation of the server are reported as terminal failures
+// of the VultrMachine.
+func (r *VultrMachineReconciler) handleVultrError(machineScope *scope.MachineScope, err error) (ctrl.Result, error) {
+	reason := vultrerrors.ReasonForError(err)
+	if reason == vultrerrors.ReasonUnknown {
+		return ctrl.Result{}, err
+	}
+
+	r.Recorder.Eventf(machineScope.VultrMachine, corev1.EventTypeWarning, string(reason), "Vultr API error: %v", err)
+
+	switch {
+	case reason == vultrerrors.ReasonRateLimited, reason == vultrerrors.ReasonTransient:
+		machineScope.Logger.Info("Vultr API is unavailable, requeueing", "reason", reason, "error", err.Error())
+		return ctrl.Result{RequeueAfter: vultrErrorRequeueAfter}, nil
+	case reason == vultrerrors.ReasonInvalidArgument && isCreateError(err):
+		machineScope.SetErrorReason(capierrors.InvalidConfigurationMachineError)
+		machineScope.SetErrorMessage(err)
+		return ctrl.Result{}, nil
+	case reason == vultrerrors.ReasonQuotaExceeded && isCreateError(err):
+		machineScope.SetErrorReason(capierrors.InsufficientResourcesMachineError)
+		machineScope.SetErrorMessage(err)
+		return ctrl.Result{}, nil
+	}
+
+	return ctrl.Result{}, err
 }
 
 func (r *VultrMachineReconciler) reconcileDelete(machineScope *scope.MachineScope) (ctrl.Result, error) {
 	log.Info("Reconciling Machine Delete")
 
+	retain := isRetained(machineScope.VultrMachine, machineScope.VultrCluster)
+
 	server, err := r.findServer(machineScope)
-	if err != nil {
-		return ctrl.Result{}, err
+	if err == nil && server != nil {
+		if retain {
+			err = r.retainServer(machineScope, server)
+		} else {
+			if result, ok, err := r.confirmDeletion(machineScope, server); !ok || err != nil {
+				return result, err
+			}
+
+			err = r.deleteServer(machineScope, server.ID)
+			if err == nil {
+				// Keep the finalizer until the server is actually gone.
+				machineScope.Logger.Info("Waiting for server to be destroyed", "serverID", server.ID)
+				return ctrl.Result{RequeueAfter: deletionRequeueAfter}, nil
+			}
+		}
 	}
 
-	if server != nil {
-		err = machineScope.VultrClient.DeleteServer(server.ID)
-		if err != nil {
-			return ctrl.Result{}, err
+	// A server which is not the VultrMachine's is never deleted, and the
+	// VultrMachine is only removed if it is annotated to be retained.
+	if isOwnershipError(err) {
+		r.Recorder.Eventf(machineScope.VultrMachine, corev1.EventTypeWarning, "DeletionRefused",
+			"Refusing to delete server: %v. Set the %s annotation to remove the VultrMachine without deleting it",
+			err, infrav1alpha2.RetainAnnotation)
+		if !retain {
+			return ctrl.Result{}, nil
 		}
+	} else if err != nil {
+		return ctrl.Result{}, err
 	}
 
 	machineScope.VultrMachine.Finalizers = util.Filter(machineScope.VultrMachine.Finalizers, infrav1alpha2.MachineFinalizer)
@@ -142,6 +248,109 @@ func (r *VultrMachineReconciler) reconcileDelete(machineScope *scope.MachineScop
 	return ctrl.Result{}, nil
 }
 
+// confirmDeletion returns true once the server may be deleted. The server of
+// a VultrMachine with deletion protection is only deleted once the VultrMachine
+// has the confirm-deletion annotation, and after a snapshot of the server has
+// been completed if the deletion policy or the annotation requests one.
+func (r *VultrMachineReconciler) confirmDeletion(machineScope *scope.MachineScope, server *vultr.Server) (ctrl.Result, bool, error) {
+	vm := machineScope.VultrMachine
+	confirmation, confirmed := vm.Annotations[infrav1alpha2.ConfirmDeletionAnnotation]
+
+	if vm.Spec.DeletionProtection && !confirmed {
+		r.Recorder.Eventf(vm, corev1.EventTypeWarning, "DeletionProtected",
+			"Server %s has deletion protection. Set the %s annotation to delete it",
+			server.ID, infrav1alpha2.ConfirmDeletionAnnotation)
+		return ctrl.Result{}, false, nil
+	}
+
+	if confirmation != infrav1alpha2.ConfirmDeletionSnapshot &&
+		vm.Spec.DeletionPolicy != infrav1alpha2.SnapshotThenDeleteDeletionPolicy {
+		return ctrl.Result{}, true, nil
+	}
+
+	if machineScope.IsBareMetal() {
+		r.Recorder.Eventf(vm, corev1.EventTypeWarning, "SnapshotUnsupported",
+			"Bare metal server %s cannot be snapshotted. Set the %s deletion policy and remove the snapshot value of the %s annotation to delete it",
+			server.ID, infrav1alpha2.DeleteDeletionPolicy, infrav1alpha2.ConfirmDeletionAnnotation)
+		return ctrl.Result{}, false, nil
+	}
+
+	if vm.Status.DeletionSnapshotID == "" {
+		snapshot, err := machineScope.VultrClient.CreateSnapshot(server.ID, fmt.Sprintf("%s/%s", vm.Namespace, vm.Name))
+		if err != nil {
+			return ctrl.Result{}, false, errors.Wrapf(err, "failed to snapshot server %q", server.ID)
+		}
+		vm.Status.DeletionSnapshotID = snapshot.ID
+
+		r.Recorder.Eventf(vm, corev1.EventTypeNormal, "SnapshotCreated",
+			"Created snapshot %s of server %s before deleting it", snapshot.ID, server.ID)
+		return ctrl.Result{RequeueAfter: operationRequeueAfter}, false, nil
+	}
+
+	snapshots, err := machineScope.VultrClient.GetSnapshots()
+	if err != nil {
+		return ctrl.Result{}, false, errors.Wrap(err, "failed to list snapshots")
+	}
+
+	for _, snapshot := range snapshots {
+		if snapshot.ID != vm.Status.DeletionSnapshotID {
+			continue
+		}
+		if snapshot.Status == "complete" {
+			r.Recorder.Eventf(vm, corev1.EventTypeNormal, "SnapshotCompleted",
+				"Snapshot %s of server %s is complete, deleting the server", snapshot.ID, server.ID)
+			return ctrl.Result{}, true, nil
+		}
+
+		machineScope.Logger.Info("Waiting for snapshot to complete", "snapshotID", snapshot.ID, "status", snapshot.Status)
+		return ctrl.Result{RequeueAfter: operationRequeueAfter}, false, nil
+	}
+
+	// The snapshot has been deleted before completing, so take another one.
+	machineScope.Logger.Info("Snapshot not found, taking another one", "snapshotID", vm.Status.DeletionSnapshotID)
+	vm.Status.DeletionSnapshotID = ""
+
+	return ctrl.Result{Requeue: true}, false, nil
+}
+
+// deleteServer deletes the server after fetching it again and verifying
+// that it is still the server of the VultrMachine.
+func (r *VultrMachineReconciler) deleteServer(machineScope *scope.MachineScope, id string) error {
+	server, err := getServer(machineScope, id)
+	if vultrerrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := verifyServerOwnership(machineScope, &server); err != nil {
+		return err
+	}
+
+	if err := deleteServer(machineScope, server.ID); err != nil {
+		return err
+	}
+	serversDeletedTotal.Inc()
+
+	machineScope.Logger.Info("Deleted server", "serverID", server.ID)
+
+	return nil
+}
+
+// retainServer keeps the server on deletion, removing the tags identifying its
+// owner so that it is not collected as an orphan of the cluster.
+func (r *VultrMachineReconciler) retainServer(machineScope *scope.MachineScope, server *vultr.Server) error {
+	if err := tagServer(machineScope, server.ID, disownedTag(server.Tag)); err != nil {
+		return errors.Wrapf(err, "failed to untag server %q", server.ID)
+	}
+
+	r.Recorder.Eventf(machineScope.VultrMachine, corev1.EventTypeNormal, "ServerRetained",
+		"Retained server %s", server.ID)
+
+	return nil
+}
+
 func (r *VultrMachineReconciler) reconcileNormal(machineScope *scope.MachineScope) (ctrl.Result, error) {
 	log.Info("Reconciling Machine")
 
@@ -155,20 +364,411 @@ func (r *VultrMachineReconciler) reconcileNormal(machineScope *scope.MachineScop
 		return ctrl.Result{}, nil
 	}
 
-	if machineScope.Machine.Spec.Bootstrap.Data == nil {
-		log.Info("Bootstrap data is not yet available.")
+	region, err := machineScope.Region()
+	if err != nil {
+		machineScope.SetErrorReason(capierrors.InvalidConfigurationMachineError)
+		machineScope.SetErrorMessage(err)
 		return ctrl.Result{}, nil
 	}
 
-	server, err := r.getOrCreate(machineScope)
-	if err != nil {
+	for _, t := range []map[string]string{machineScope.VultrCluster.Spec.AdditionalTags, machineScope.VultrMachine.Spec.AdditionalTags} {
+		if err := tags.Validate(t); err != nil {
+			machineScope.SetErrorReason(capierrors.InvalidConfigurationMachineError)
+			machineScope.SetErrorMessage(err)
+			return ctrl.Result{}, nil
+		}
+	}
+
+	// DDoS protection can only be requested when the server is created.
+	if spec := machineScope.VultrMachine.Spec; spec.DDoSProtection && spec.ProviderID == nil && !machineScope.IsBareMetal() {
+		available, err := ddosProtectionAvailable(machineScope, region)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if !available {
+			machineScope.SetErrorReason(capierrors.InvalidConfigurationMachineError)
+			machineScope.SetErrorMessage(errors.Errorf("DDoS protection is not available in region %d", region))
+			return ctrl.Result{}, nil
+		}
+	}
+
+	// Adopt the pre-existing server instead of creating a new one.
+	// Adopted servers are already provisioned, so bootstrap data is not required.
+	if serverID, ok := machineScope.VultrMachine.Annotations[infrav1alpha2.AdoptServerAnnotation]; ok && machineScope.VultrMachine.Spec.ProviderID == nil {
+		server, err := r.adoptServer(machineScope, serverID, region)
+		if err != nil || server == nil {
+			return ctrl.Result{}, err
+		}
+
+		delete(machineScope.VultrMachine.Annotations, infrav1alpha2.AdoptServerAnnotation)
+		r.setServerStatus(machineScope, server)
+
+		return ctrl.Result{}, nil
+	}
+
+	server, err := r.getOrCreate(machineScope, region)
+	if err != nil || server == nil {
+		return ctrl.Result{}, err
+	}
+
+	r.setServerStatus(machineScope, server)
+
+	if err := r.reconcileTags(machineScope, server); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.attachIPv6ReservedIP(machineScope, server, region); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.reconcileAutoBackups(machineScope, server); err != nil {
 		return ctrl.Result{}, err
 	}
 
-	machineScope.VultrMachine.Spec.ProviderID = pointer.StringPtr(fmt.Sprintf("vultr:////%s", server.ID))
+	if result, ok, err := r.reconcileReinstall(machineScope, server); !ok || err != nil {
+		return result, err
+	}
+
+	if err := r.reconcilePower(machineScope, server); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return r.reconcilePlan(machineScope, server)
+}
+
+// reconcilePower executes the reboot and halt requested by annotations, and
+// then starts or halts the server to match the PowerState of the VultrMachine.
+func (r *VultrMachineReconciler) reconcilePower(machineScope *scope.MachineScope, server *vultr.Server) error {
+	vm := machineScope.VultrMachine
+
+	if _, ok := vm.Annotations[infrav1alpha2.RebootAnnotation]; ok {
+		if err := rebootServer(machineScope, server.ID); err != nil {
+			return errors.Wrapf(err, "failed to reboot server %q", server.ID)
+		}
+		r.Recorder.Eventf(vm, corev1.EventTypeNormal, "Rebooted", "Rebooted server %s", server.ID)
+		delete(vm.Annotations, infrav1alpha2.RebootAnnotation)
+		r.setPowerStatus(machineScope, infrav1alpha2.PowerStatusStarting)
+	}
+
+	if _, ok := vm.Annotations[infrav1alpha2.HaltAnnotation]; ok {
+		if err := haltServer(machineScope, server.ID); err != nil {
+			return errors.Wrapf(err, "failed to halt server %q", server.ID)
+		}
+		r.Recorder.Eventf(vm, corev1.EventTypeNormal, "Halted", "Halted server %s", server.ID)
+		delete(vm.Annotations, infrav1alpha2.HaltAnnotation)
+		r.setPowerStatus(machineScope, infrav1alpha2.PowerStatusStopped)
+		return nil
+	}
+
+	desired := vm.Spec.PowerState
+	if machineScope.IsBareMetal() || desired == "" || vm.Status.PowerStatus == nil || *vm.Status.PowerStatus == desired {
+		return nil
+	}
+
+	// The power status is not changed while the server is being provisioned
+	// or is locked by another operation.
+	if server.Status != string(infrav1alpha2.SubscriptionStatusActive) || server.ServerState == string(infrav1alpha2.ServerStateLocked) {
+		return nil
+	}
+
+	switch desired {
+	case infrav1alpha2.PowerStatusRunning:
+		if *vm.Status.PowerStatus == infrav1alpha2.PowerStatusStarting {
+			return nil
+		}
+		if err := machineScope.VultrClient.StartServer(server.ID); err != nil {
+			return errors.Wrapf(err, "failed to start server %q", server.ID)
+		}
+		r.Recorder.Eventf(vm, corev1.EventTypeNormal, "Started", "Started server %s", server.ID)
+		r.setPowerStatus(machineScope, infrav1alpha2.PowerStatusStarting)
+	case infrav1alpha2.PowerStatusStopped:
+		if err := machineScope.VultrClient.HaltServer(server.ID); err != nil {
+			return errors.Wrapf(err, "failed to halt server %q", server.ID)
+		}
+		r.Recorder.Eventf(vm, corev1.EventTypeNormal, "Halted", "Halted server %s", server.ID)
+		r.setPowerStatus(machineScope, infrav1alpha2.PowerStatusStopped)
+	}
+
+	return nil
+}
+
+// setPowerStatus records the power status the server is expected to reach
+// after a power action. Bare metal servers do not report their power status.
+func (r *VultrMachineReconciler) setPowerStatus(machineScope *scope.MachineScope, powerStatus infrav1alpha2.PowerStatus) {
+	if machineScope.IsBareMetal() {
+		return
+	}
+
+	machineScope.VultrMachine.Status.PowerStatus = &powerStatus
+}
+
+// reconcileReinstall reinstalls the server if the VultrMachine has the
+// reinstall annotation, reporting the progress in the Reinstalled condition.
+// It returns true once no reinstall is in progress.
+func (r *VultrMachineReconciler) reconcileReinstall(machineScope *scope.MachineScope, server *vultr.Server) (ctrl.Result, bool, error) {
+	vm := machineScope.VultrMachine
+	if _, ok := vm.Annotations[infrav1alpha2.ReinstallAnnotation]; !ok {
+		return ctrl.Result{}, true, nil
+	}
+
+	c := machineScope.GetCondition(infrav1alpha2.ReinstalledCondition)
+	if c == nil || c.Reason != reinstallingReason {
+		if err := reinstallServer(machineScope, server.ID); err != nil {
+			return ctrl.Result{}, false, errors.Wrapf(err, "failed to reinstall server %q", server.ID)
+		}
+
+		message := fmt.Sprintf("Reinstalling server %s", server.ID)
+		machineScope.SetCondition(infrav1alpha2.ReinstalledCondition, corev1.ConditionFalse, reinstallingReason, message)
+		r.Recorder.Event(vm, corev1.EventTypeNormal, "ReinstallStarted", message)
+		return ctrl.Result{RequeueAfter: operationRequeueAfter}, false, nil
+	}
+
+	if !serverReady(machineScope, server) {
+		machineScope.Logger.Info("Waiting for server to be reinstalled", "serverID", server.ID,
+			"status", server.Status, "serverState", server.ServerState)
+		return ctrl.Result{RequeueAfter: operationRequeueAfter}, false, nil
+	}
+
+	message := fmt.Sprintf("Reinstalled server %s", server.ID)
+	machineScope.SetCondition(infrav1alpha2.ReinstalledCondition, corev1.ConditionTrue, "Reinstalled", message)
+	r.Recorder.Event(vm, corev1.EventTypeNormal, "Reinstalled", message)
+	delete(vm.Annotations, infrav1alpha2.ReinstallAnnotation)
+
+	return ctrl.Result{}, true, nil
+}
+
+// serverReady returns true if the server is active and no operation is in
+// progress on it. Bare metal servers only report their subscription status.
+func serverReady(machineScope *scope.MachineScope, server *vultr.Server) bool {
+	if server.Status != string(infrav1alpha2.SubscriptionStatusActive) {
+		return false
+	}
+
+	return machineScope.IsBareMetal() || server.ServerState == string(infrav1alpha2.ServerStateOK)
+}
+
+// setServerStatus records the server's ProviderID and state on the VultrMachine.
+func (r *VultrMachineReconciler) setServerStatus(machineScope *scope.MachineScope, server *vultr.Server) {
+	machineScope.VultrMachine.Spec.ProviderID = pointer.StringPtr(providerID(machineScope, server.ID))
+
+	subscriptionStatus := infrav1alpha2.SubscriptionStatus(server.Status)
+	machineScope.VultrMachine.Status.SubscriptionStatus = &subscriptionStatus
+
+	// Bare metal servers report neither power status nor server state.
+	if !machineScope.IsBareMetal() {
+		powerStatus := infrav1alpha2.PowerStatus(server.PowerStatus)
+		serverState := infrav1alpha2.ServerState(server.ServerState)
+		machineScope.VultrMachine.Status.PowerStatus = &powerStatus
+		machineScope.VultrMachine.Status.ServerState = &serverState
+	}
+
+	if !machineScope.VultrMachine.Status.Ready {
+		machineReadySeconds.Observe(time.Since(machineScope.VultrMachine.CreationTimestamp.Time).Seconds())
+	}
 	machineScope.VultrMachine.Status.Ready = true
 
-	return ctrl.Result{}, nil
+	// The server exists, so failures reported by previous reconciles are resolved.
+	machineScope.ClearError()
+}
+
+// reconcileTags sets the tag of the server to the one of the machine
+// if it has drifted, e.g. after the additional tags were changed.
+func (r *VultrMachineReconciler) reconcileTags(machineScope *scope.MachineScope, server *vultr.Server) error {
+	tag := machineScope.Tags().String()
+	if server.Tag == tag {
+		return nil
+	}
+
+	machineScope.Logger.Info("Updating server tag", "serverID", server.ID, "tag", tag)
+	if err := tagServer(machineScope, server.ID, tag); err != nil {
+		return errors.Wrapf(err, "failed to tag server %q", server.ID)
+	}
+	server.Tag = tag
+
+	return nil
+}
+
+// reconcileAutoBackups enables the automatic backups of the server if the
+// VultrMachine requests them. Backups are never disabled, as that discards
+// them, so such a mismatch is only reported in the AutoBackups condition.
+func (r *VultrMachineReconciler) reconcileAutoBackups(machineScope *scope.MachineScope, server *vultr.Server) error {
+	if machineScope.IsBareMetal() {
+		return nil
+	}
+
+	enabled := server.AutoBackups == "yes"
+	switch {
+	case enabled && machineScope.VultrMachine.Spec.EnableAutoBackups:
+		machineScope.SetCondition(infrav1alpha2.AutoBackupsCondition, corev1.ConditionTrue, "AutoBackupsApplied",
+			"Automatic backups are enabled")
+
+	case !enabled && !machineScope.VultrMachine.Spec.EnableAutoBackups:
+		machineScope.SetCondition(infrav1alpha2.AutoBackupsCondition, corev1.ConditionTrue, "AutoBackupsApplied",
+			"Automatic backups are disabled")
+
+	case !enabled:
+		if err := r.VultrClients.Post(machineScope.VultrClient, "server/backup_enable", url.Values{"SUBID": {server.ID}}); err != nil {
+			return errors.Wrapf(err, "failed to enable automatic backups of server %q", server.ID)
+		}
+		r.Recorder.Eventf(machineScope.VultrMachine, corev1.EventTypeNormal, "AutoBackupsEnabled",
+			"Enabled automatic backups of server %s", server.ID)
+		machineScope.SetCondition(infrav1alpha2.AutoBackupsCondition, corev1.ConditionTrue, "AutoBackupsApplied",
+			"Automatic backups are enabled")
+
+	default:
+		machineScope.SetCondition(infrav1alpha2.AutoBackupsCondition, corev1.ConditionFalse, "AutoBackupsNotDisabled",
+			"Automatic backups are enabled, and are not disabled as that would discard the backups")
+	}
+
+	return nil
+}
+
+// reconcilePlan upgrades the server to the plan of the VultrMachine if its
+// resize policy is InPlace, reporting the progress in the Resized condition.
+func (r *VultrMachineReconciler) reconcilePlan(machineScope *scope.MachineScope, server *vultr.Server) (ctrl.Result, error) {
+	spec := machineScope.VultrMachine.Spec
+	if machineScope.IsBareMetal() || spec.ResizePolicy != infrav1alpha2.InPlaceResizePolicy {
+		return ctrl.Result{}, nil
+	}
+
+	// The server is locked while it is being upgraded, and may report the
+	// new plan before the upgrade has completed.
+	if server.ServerState != string(infrav1alpha2.ServerStateOK) {
+		if c := machineScope.GetCondition(infrav1alpha2.ResizedCondition); c != nil && c.Reason == resizingReason {
+			machineScope.Logger.Info("Waiting for server to be resized", "serverID", server.ID, "serverState", server.ServerState)
+			return ctrl.Result{RequeueAfter: operationRequeueAfter}, nil
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if server.PlanID == spec.PlanID {
+		if c := machineScope.GetCondition(infrav1alpha2.ResizedCondition); c != nil && c.Reason == resizingReason {
+			r.Recorder.Eventf(machineScope.VultrMachine, corev1.EventTypeNormal, "Resized",
+				"Resized server %s to plan %d", server.ID, spec.PlanID)
+		}
+		machineScope.SetCondition(infrav1alpha2.ResizedCondition, corev1.ConditionTrue, "PlanApplied",
+			fmt.Sprintf("Server runs plan %d", spec.PlanID))
+		return ctrl.Result{}, nil
+	}
+
+	plans, err := machineScope.VultrClient.ListUpgradePlansForServer(server.ID)
+	if err != nil {
+		return ctrl.Result{}, errors.Wrapf(err, "failed to list upgrade plans of server %q", server.ID)
+	}
+
+	upgradable := false
+	for _, p := range plans {
+		if p == spec.PlanID {
+			upgradable = true
+			break
+		}
+	}
+	if !upgradable {
+		message := fmt.Sprintf("Server %s cannot be upgraded from plan %d to plan %d", server.ID, server.PlanID, spec.PlanID)
+		machineScope.SetCondition(infrav1alpha2.ResizedCondition, corev1.ConditionFalse, "ResizeNotAllowed", message)
+		r.Recorder.Event(machineScope.VultrMachine, corev1.EventTypeWarning, "ResizeNotAllowed", message)
+		return ctrl.Result{}, nil
+	}
+
+	if err := machineScope.VultrClient.ChangePlanOfServer(server.ID, spec.PlanID); err != nil {
+		return ctrl.Result{}, errors.Wrapf(err, "failed to upgrade server %q to plan %d", server.ID, spec.PlanID)
+	}
+
+	message := fmt.Sprintf("Upgrading server %s from plan %d to plan %d", server.ID, server.PlanID, spec.PlanID)
+	machineScope.SetCondition(infrav1alpha2.ResizedCondition, corev1.ConditionFalse, resizingReason, message)
+	r.Recorder.Event(machineScope.VultrMachine, corev1.EventTypeNormal, "ResizeStarted", message)
+
+	return ctrl.Result{RequeueAfter: operationRequeueAfter}, nil
+}
+
+// attachIPv6ReservedIP attaches the IPv6 reserved IP of a DualStack cluster to
+// the control-plane server. Unlike IPv4 ones, it cannot be attached when the
+// server is created, so this is done once the server is active.
+func (r *VultrMachineReconciler) attachIPv6ReservedIP(machineScope *scope.MachineScope, server *vultr.Server, region int) error {
+	id := machineScope.VultrCluster.Spec.ReservedIPv6ID
+	if id == "" || !machineScope.IsControlPlane() || machineScope.IsBareMetal() || region != machineScope.VultrCluster.Spec.Region {
+		return nil
+	}
+
+	if server.Status != string(infrav1alpha2.SubscriptionStatusActive) {
+		return nil
+	}
+
+	ip, err := machineScope.VultrClient.GetReservedIP(id)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get reserved IP %q", id)
+	}
+
+	// The reserved IP is held by another control-plane machine.
+	if ip.AttachedTo != "" {
+		return nil
+	}
+
+	subnet := fmt.Sprintf("%s/%d", ip.Subnet, ip.SubnetSize)
+	if err := machineScope.VultrClient.AttachReservedIP(subnet, server.ID); err != nil {
+		return errors.Wrapf(err, "failed to attach reserved IP %q", subnet)
+	}
+	r.Recorder.Eventf(machineScope.VultrMachine, corev1.EventTypeNormal, "ReservedIPAttached",
+		"Attached reserved IP %s to server %s", subnet, server.ID)
+
+	return nil
+}
+
+// adoptServer takes over the pre-existing server identified by serverID.
+// The server is validated against the VultrMachine and VultrCluster spec
+// and tagged as owned by the cluster, but it is never reinstalled. A server
+// which cannot be adopted is reported as a terminal failure of the
+// VultrMachine, and no server is returned.
+func (r *VultrMachineReconciler) adoptServer(machineScope *scope.MachineScope, serverID string, region int) (*vultr.Server, error) {
+	machineScope.Logger.Info("Adopting existing server", "serverID", serverID)
+
+	server, err := getServer(machineScope, serverID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get server %q to adopt", serverID)
+	}
+
+	if err := validateAdoptedServer(machineScope, &server, region); err != nil {
+		machineScope.SetErrorReason(capierrors.InvalidConfigurationMachineError)
+		machineScope.SetErrorMessage(err)
+		r.Recorder.Eventf(machineScope.VultrMachine, corev1.EventTypeWarning, "AdoptionRefused",
+			"Refusing to adopt server: %v", err)
+		return nil, nil
+	}
+
+	if err := r.reconcileTags(machineScope, &server); err != nil {
+		return nil, err
+	}
+
+	return &server, nil
+}
+
+// validateAdoptedServer returns an error if the server does not match the spec
+// of the VultrMachine, or is already owned by another cluster or machine.
+func validateAdoptedServer(machineScope *scope.MachineScope, server *vultr.Server, region int) error {
+	spec := machineScope.VultrMachine.Spec
+
+	if server.RegionID != region {
+		return errors.Errorf("server %q is in region %d, expected %d", server.ID, server.RegionID, region)
+	}
+
+	if spec.PlanID != 0 && server.PlanID != spec.PlanID {
+		return errors.Errorf("server %q has plan %d, expected %d", server.ID, server.PlanID, spec.PlanID)
+	}
+
+	if spec.OSID != 0 && server.OSID != strconv.Itoa(spec.OSID) {
+		return errors.Errorf("server %q has OS %s, expected %d", server.ID, server.OSID, spec.OSID)
+	}
+
+	t := tags.Parse(server.Tag)
+	if t[tags.ClusterKey] != "" && !machineScope.OwnsServer(server) {
+		return errors.Errorf("server %q is already owned by another cluster (tag %q)", server.ID, server.Tag)
+	}
+
+	if m := t[tags.MachineKey]; m != "" && m != machineScope.VultrMachine.Name {
+		return errors.Errorf("server %q is already owned by machine %q", server.ID, m)
+	}
+
+	return nil
 }
 
 func (r *VultrMachineReconciler) findServer(machineScope *scope.MachineScope) (*vultr.Server, error) {
@@ -185,33 +785,60 @@ func (r *VultrMachineReconciler) findServer(machineScope *scope.MachineScope) (*
 
 	// If the ProviderID populated, get the server using the ID.
 	if err == nil {
-		server, err := machineScope.VultrClient.GetServer(pid.ID())
-		if err != nil && err.Error() == "Invalid server." {
+		server, err := getServer(machineScope, pid.ID())
+		if vultrerrors.IsNotFound(err) {
 			return nil, nil
 		}
+		if err != nil {
+			return nil, err
+		}
 
-		if err == nil {
-			return &server, nil
+		// Never act on a server of another machine, e.g. if the ProviderID was copied.
+		if err := verifyServerOwnership(machineScope, &server); err != nil {
+			return nil, err
 		}
+
+		return &server, nil
 	}
 
-	// If the ProviderID is empty, try to get the server using tag and name (label).
-	tag := fmt.Sprintf("%s:owned", machineScope.VultrCluster.Name)
-	servers, err := machineScope.VultrClient.GetServersByTag(tag)
+	// If the ProviderID is empty, try to get the server using its tag. Legacy
+	// tags only hold the cluster name, so a server with one may belong to a
+	// same-named cluster of another management cluster: it is only trusted
+	// once its id is recorded in the ProviderID, and then retagged.
+	servers, err := listServers(machineScope)
 	if err != nil {
 		return nil, err
 	}
 
 	for _, s := range servers {
-		if s.Name == machineScope.VultrMachine.GetName() {
-			return &s, nil
+		if tags.Parse(s.Tag).IsLegacy() || verifyServerOwnership(machineScope, &s) != nil {
+			continue
 		}
+		return &s, nil
 	}
 
 	return nil, nil
 }
 
-func (r *VultrMachineReconciler) getOrCreate(machineScope *scope.MachineScope) (*vultr.Server, error) {
+// ddosProtectionAvailable returns true if DDoS protection is available in the region.
+func ddosProtectionAvailable(machineScope *scope.MachineScope, region int) (bool, error) {
+	regions, err := machineScope.VultrClient.GetRegions()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to list regions")
+	}
+
+	for _, rg := range regions {
+		if rg.ID == region {
+			return rg.Ddos, nil
+		}
+	}
+
+	return false, nil
+}
+
+// getOrCreate returns the server of the VultrMachine, creating it if needed.
+// It returns nil if the server cannot be created yet.
+func (r *VultrMachineReconciler) getOrCreate(machineScope *scope.MachineScope, region int) (*vultr.Server, error) {
 	server, err := r.findServer(machineScope)
 	if err != nil {
 		return nil, err
@@ -219,6 +846,13 @@ func (r *VultrMachineReconciler) getOrCreate(machineScope *scope.MachineScope) (
 
 	// Create a new server if we couldn't get a server
 	if server == nil {
+		// Existing servers are already provisioned, so only new servers
+		// need bootstrap data.
+		if machineScope.Machine.Spec.Bootstrap.Data == nil {
+			machineScope.Logger.Info("Bootstrap data is not yet available.")
+			return nil, nil
+		}
+
 		sshKeyID, err := r.getSSHKeyIDByName(machineScope.VultrClient, &machineScope.VultrMachine.Spec.SSHKeyName)
 		if err != nil {
 			return nil, err
@@ -233,13 +867,26 @@ func (r *VultrMachineReconciler) getOrCreate(machineScope *scope.MachineScope) (
 			Hostname: machineScope.Machine.Name,
 			UserData: string(userdata),
 			SSHKey:   sshKeyID,
-			Tag:      fmt.Sprintf("%s:owned", machineScope.VultrCluster.Name),
+			Tag:      machineScope.Tags().String(),
+			IPV6:     machineScope.IPv6Enabled(),
+
+			AutoBackups:          machineScope.VultrMachine.Spec.EnableAutoBackups,
+			DontNotifyOnActivate: !machineScope.NotifyActivate(),
 		}
 
-		// Set ReservedIP if the Machine has control-plane label
+		// Set ReservedIP if the Machine has control-plane label.
+		// Reserved IPs can only be attached to cloud compute servers in their
+		// own region, so other control-plane machines go without it.
 		labels := machineScope.Machine.GetLabels()
 		if labels["cluster.x-k8s.io/control-plane"] == "true" {
-			options.ReservedIP = machineScope.VultrCluster.Status.APIEndpoints[0].Host
+			switch {
+			case machineScope.IsBareMetal():
+				machineScope.Logger.Info("Not attaching the reserved IP to a bare metal server")
+			case region != machineScope.VultrCluster.Spec.Region:
+				machineScope.Logger.Info("Not attaching the reserved IP to a server outside the cluster region", "region", region)
+			default:
+				options.ReservedIP = machineScope.VultrCluster.Status.APIEndpoints[0].Host
+			}
 		}
 
 		// Set ScriptID if the Machine has Vultr Script ID
@@ -247,12 +894,19 @@ func (r *VultrMachineReconciler) getOrCreate(machineScope *scope.MachineScope) (
 			options.Script = machineScope.VultrMachine.Spec.ScriptID
 		}
 
-		srv, err := machineScope.VultrClient.CreateServer(machineScope.Machine.Name,
-			machineScope.VultrCluster.Spec.Region, machineScope.VultrMachine.Spec.PlanID,
-			machineScope.VultrMachine.Spec.OSID, options)
+		vultrClient := machineScope.VultrClient
+		if machineScope.VultrMachine.Spec.DDoSProtection && !machineScope.IsBareMetal() {
+			// The library has no option for DDoS protection.
+			vultrClient = r.VultrClients.WithFormValues(vultrClient, "server/create", url.Values{
+				"ddos_protection": {"yes"},
+			})
+		}
+
+		srv, err := createServer(machineScope, vultrClient, machineScope.Machine.Name, region, options)
 		if err != nil {
-			return nil, err
+			return nil, &createError{err}
 		}
+		serversCreatedTotal.Inc()
 
 		server = &srv
 	}
@@ -274,8 +928,82 @@ func (r *VultrMachineReconciler) getSSHKeyIDByName(vultrClient *vultr.Client, ke
 	return "", fmt.Errorf("SSH Key '%s' is not found.", *keyName)
 }
 
-func (r *VultrMachineReconciler) SetupWithManager(mgr ctrl.Manager) error {
+func (r *VultrMachineReconciler) SetupWithManager(mgr ctrl.Manager, options controller.Options) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&infrastructurev1alpha2.VultrMachine{}).
+		Watches(
+			&source.Kind{Type: &clusterv1.Machine{}},
+			&handler.EnqueueRequestsFromMapFunc{
+				ToRequests: util.MachineToInfrastructureMapFunc(infrav1alpha2.GroupVersion.WithKind("VultrMachine")),
+			},
+		).
+		Watches(
+			&source.Kind{Type: &clusterv1.Cluster{}},
+			&handler.EnqueueRequestsFromMapFunc{
+				ToRequests: handler.ToRequestsFunc(r.ClusterToVultrMachines),
+			},
+		).
+		Watches(
+			&source.Kind{Type: &infrav1alpha2.VultrCluster{}},
+			&handler.EnqueueRequestsFromMapFunc{
+				ToRequests: handler.ToRequestsFunc(r.VultrClusterToVultrMachines),
+			},
+		).
+		WithOptions(options).
+		WithEventFilter(resourceHasFilterLabel(r.WatchFilterValue)).
 		Complete(r)
 }
+
+// ClusterToVultrMachines is a handler.ToRequestsFunc to be used to enqueue
+// requests for reconciliation of VultrMachines of the Cluster.
+func (r *VultrMachineReconciler) ClusterToVultrMachines(o handler.MapObject) []ctrl.Request {
+	c, ok := o.Object.(*clusterv1.Cluster)
+	if !ok {
+		r.Log.Error(errors.Errorf("expected a Cluster but got a %T", o.Object), "failed to get VultrMachines for Cluster")
+		return nil
+	}
+
+	return r.requestsForCluster(c.Namespace, c.Name)
+}
+
+// VultrClusterToVultrMachines is a handler.ToRequestsFunc to be used to enqueue
+// requests for reconciliation of VultrMachines of the cluster owning the VultrCluster.
+func (r *VultrMachineReconciler) VultrClusterToVultrMachines(o handler.MapObject) []ctrl.Request {
+	c, ok := o.Object.(*infrav1alpha2.VultrCluster)
+	if !ok {
+		r.Log.Error(errors.Errorf("expected a VultrCluster but got a %T", o.Object), "failed to get VultrMachines for VultrCluster")
+		return nil
+	}
+
+	cluster, err := util.GetOwnerCluster(context.Background(), r.Client, c.ObjectMeta)
+	if err != nil || cluster == nil {
+		return nil
+	}
+
+	return r.requestsForCluster(cluster.Namespace, cluster.Name)
+}
+
+// requestsForCluster returns the requests for the VultrMachines of all the Machines in the cluster.
+func (r *VultrMachineReconciler) requestsForCluster(namespace, clusterName string) []ctrl.Request {
+	machines := &clusterv1.MachineList{}
+	if err := r.List(context.Background(), machines,
+		client.InNamespace(namespace),
+		client.MatchingLabels{clusterv1.MachineClusterLabelName: clusterName},
+	); err != nil {
+		r.Log.Error(err, "failed to list Machines", "cluster", clusterName)
+		return nil
+	}
+
+	gvk := infrav1alpha2.GroupVersion.WithKind("VultrMachine")
+	requests := []ctrl.Request{}
+	for _, m := range machines.Items {
+		if m.Spec.InfrastructureRef.GroupVersionKind() != gvk {
+			continue
+		}
+		requests = append(requests, ctrl.Request{
+			NamespacedName: client.ObjectKey{Namespace: m.Namespace, Name: m.Spec.InfrastructureRef.Name},
+		})
+	}
+
+	return requests
+}
@@ -0,0 +1,59 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	vultr "github.com/JamesClonk/vultr/lib"
+)
+
+func TestValidateAdoptedServer(t *testing.T) {
+	owner := newTestVultrCluster("capi", "uid-1")
+	otherNamespace := newTestVultrCluster("capi", "uid-1")
+	otherNamespace.Namespace = "other"
+
+	tests := []struct {
+		name    string
+		server  vultr.Server
+		wantErr bool
+	}{
+		{"untagged server", vultr.Server{RegionID: 1, PlanID: 201, OSID: "270"}, false},
+		{"server with other tags", vultr.Server{RegionID: 1, PlanID: 201, OSID: "270", Tag: "team=infra"}, false},
+		{"server of the machine", vultr.Server{RegionID: 1, PlanID: 201, OSID: "270", Tag: machineTag(owner, "m1")}, false},
+		{"legacy tag", vultr.Server{RegionID: 1, PlanID: 201, OSID: "270", Tag: "capi:owned"}, false},
+		{"another region", vultr.Server{RegionID: 2, PlanID: 201, OSID: "270"}, true},
+		{"another plan", vultr.Server{RegionID: 1, PlanID: 202, OSID: "270"}, true},
+		{"another OS", vultr.Server{RegionID: 1, PlanID: 201, OSID: "271"}, true},
+		{"server of another machine", vultr.Server{RegionID: 1, PlanID: 201, OSID: "270", Tag: machineTag(owner, "m2")}, true},
+		{"same-named cluster with another UID", vultr.Server{RegionID: 1, PlanID: 201, OSID: "270", Tag: machineTag(newTestVultrCluster("capi", "uid-2"), "m1")}, true},
+		{"same-named cluster in another namespace", vultr.Server{RegionID: 1, PlanID: 201, OSID: "270", Tag: machineTag(otherNamespace, "m1")}, true},
+		{"legacy tag of another cluster", vultr.Server{RegionID: 1, PlanID: 201, OSID: "270", Tag: "other:owned"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			machineScope := newTestMachineScope(owner, "m1")
+			machineScope.VultrMachine.Spec.PlanID = 201
+			machineScope.VultrMachine.Spec.OSID = 270
+
+			tt.server.ID = "1"
+			if err := validateAdoptedServer(machineScope, &tt.server, 1); (err != nil) != tt.wantErr {
+				t.Errorf("validateAdoptedServer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
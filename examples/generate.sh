@@ -50,6 +50,7 @@ mkdir -p "${OUTPUT_DIR}"
 # Generate cluster manifest
 kustomize build "${SOURCE_DIR}/cluster" | envsubst > "${CLUSTER_GENERATED_FILE}"
 echo "Generated ${CLUSTER_GENERATED_FILE}"
+echo "⚠️ WARNING: ${CLUSTER_GENERATED_FILE} includes Vultr credentials"
 
 # Generate controlplane manifest
 kustomize build "${SOURCE_DIR}/controlplane" | envsubst > "${CONTROLPLANE_GENERATED_FILE}"
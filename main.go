@@ -17,24 +17,27 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
 	"time"
 
 	infrastructurev1alpha2 "github.com/yukirii/cluster-api-provider-vultr/api/v1alpha2"
 	"github.com/yukirii/cluster-api-provider-vultr/controllers"
+	"github.com/yukirii/cluster-api-provider-vultr/pkg/cloud/vultrclient"
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 	// +kubebuilder:scaffold:imports
 )
 
 var (
-	scheme     = runtime.NewScheme()
-	setupLog   = ctrl.Log.WithName("setup")
-	syncPeriod = time.Second * 60
+	scheme   = runtime.NewScheme()
+	setupLog = ctrl.Log.WithName("setup")
 )
 
 func init() {
@@ -46,43 +49,124 @@ func init() {
 
 func main() {
 	var metricsAddr string
+	var webhookPort int
 	var enableLeaderElection bool
+	var watchNamespace string
+	var watchFilterValue string
+	var vultrMachineConcurrency int
+	var vultrClusterConcurrency int
+	var syncPeriod time.Duration
+	var orphanGCInterval time.Duration
+	var orphanGCGracePeriod time.Duration
+	var orphanGCDelete bool
+	var vultrOptions vultrclient.Options
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
+	flag.IntVar(&webhookPort, "webhook-port", 0,
+		"Webhook Server port. Set to 0 to disable the webhooks.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&watchNamespace, "namespace", "",
+		"Namespace that the controller watches to reconcile objects. If unspecified, the controller watches for objects across all namespaces.")
+	flag.StringVar(&watchFilterValue, "watch-filter", "",
+		fmt.Sprintf("Label value that the controller watches to reconcile objects. Label key is always %s. If unspecified, the controller watches for all objects.", controllers.WatchLabel))
+	flag.IntVar(&vultrMachineConcurrency, "vultrmachine-concurrency", 1,
+		"Number of VultrMachines to process simultaneously.")
+	flag.IntVar(&vultrClusterConcurrency, "vultrcluster-concurrency", 1,
+		"Number of VultrClusters to process simultaneously.")
+	flag.DurationVar(&syncPeriod, "sync-period", 60*time.Second,
+		"The minimum interval at which watched resources are reconciled.")
+	flag.DurationVar(&orphanGCInterval, "orphan-gc-interval", 10*time.Minute,
+		"The interval at which orphaned Vultr resources are looked for. Set to 0 to disable.")
+	flag.DurationVar(&orphanGCGracePeriod, "orphan-gc-grace-period", time.Hour,
+		"How long a Vultr resource must stay orphaned before it is reported or deleted.")
+	flag.BoolVar(&orphanGCDelete, "orphan-gc-delete", false,
+		"Delete orphaned Vultr resources instead of only reporting them.")
+	flag.Float64Var(&vultrOptions.QPS, "vultr-api-qps", vultrclient.DefaultOptions.QPS,
+		"The maximum number of Vultr API requests per second for each API key.")
+	flag.IntVar(&vultrOptions.Burst, "vultr-api-burst", vultrclient.DefaultOptions.Burst,
+		"The maximum burst of Vultr API requests.")
+	flag.IntVar(&vultrOptions.MaxRetries, "vultr-api-max-retries", vultrclient.DefaultOptions.MaxRetries,
+		"The maximum number of retries of a Vultr API request failing with a transient error.")
+	flag.DurationVar(&vultrOptions.CacheTTL, "vultr-api-cache-ttl", vultrclient.DefaultOptions.CacheTTL,
+		"How long the responses of Vultr API list endpoints are cached. Set to 0 to disable.")
 	flag.Parse()
 
 	ctrl.SetLogger(zap.Logger(true))
 
+	// Managers with different watch filters must not compete for the same lock.
+	// The default lock is kept otherwise, so that upgrades do not elect two leaders.
+	var leaderElectionID string
+	if watchFilterValue != "" {
+		leaderElectionID = fmt.Sprintf("controller-leader-election-capv-%s", watchFilterValue)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		SyncPeriod:         &syncPeriod,
 		Scheme:             scheme,
 		MetricsBindAddress: metricsAddr,
 		LeaderElection:     enableLeaderElection,
-		Port:               9443,
+		LeaderElectionID:   leaderElectionID,
+		Namespace:          watchNamespace,
+		Port:               webhookPort,
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
+	vultrClients := vultrclient.NewPool(vultrOptions)
+
 	if err = (&controllers.VultrClusterReconciler{
-		Client:   mgr.GetClient(),
-		Log:      ctrl.Log.WithName("controllers").WithName("VultrCluster"),
-		Recorder: mgr.GetEventRecorderFor("vultrcluster-controller"),
-	}).SetupWithManager(mgr); err != nil {
+		Client:           mgr.GetClient(),
+		Log:              ctrl.Log.WithName("controllers").WithName("VultrCluster"),
+		Recorder:         mgr.GetEventRecorderFor("vultrcluster-controller"),
+		VultrClients:     vultrClients,
+		WatchFilterValue: watchFilterValue,
+	}).SetupWithManager(mgr, controller.Options{MaxConcurrentReconciles: vultrClusterConcurrency}); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "VultrCluster")
 		os.Exit(1)
 	}
 	if err = (&controllers.VultrMachineReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("VultrMachine"),
-	}).SetupWithManager(mgr); err != nil {
+		Client:           mgr.GetClient(),
+		Log:              ctrl.Log.WithName("controllers").WithName("VultrMachine"),
+		Recorder:         mgr.GetEventRecorderFor("vultrmachine-controller"),
+		VultrClients:     vultrClients,
+		WatchFilterValue: watchFilterValue,
+	}).SetupWithManager(mgr, controller.Options{MaxConcurrentReconciles: vultrMachineConcurrency}); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "VultrMachine")
 		os.Exit(1)
 	}
+	if webhookPort > 0 {
+		if err = (&infrastructurev1alpha2.VultrMachine{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "VultrMachine")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
+	metrics.Registry.MustRegister(&controllers.MetricsCollector{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("MetricsCollector"),
+
+		WatchFilterValue: watchFilterValue,
+	})
+
+	if orphanGCInterval > 0 {
+		if err = mgr.Add(&controllers.OrphanCollector{
+			Client:       mgr.GetClient(),
+			Log:          ctrl.Log.WithName("controllers").WithName("OrphanCollector"),
+			VultrClients: vultrClients,
+			Interval:     orphanGCInterval,
+			GracePeriod:  orphanGCGracePeriod,
+			Delete:       orphanGCDelete,
+
+			WatchFilterValue: watchFilterValue,
+		}); err != nil {
+			setupLog.Error(err, "unable to add orphan collector")
+			os.Exit(1)
+		}
+	}
+
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
 		setupLog.Error(err, "problem running manager")
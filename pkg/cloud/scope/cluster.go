@@ -17,21 +17,26 @@ package scope
 
 import (
 	"context"
-	"os"
 
 	"github.com/pkg/errors"
 	infrav1alpha2 "github.com/yukirii/cluster-api-provider-vultr/api/v1alpha2"
+	"github.com/yukirii/cluster-api-provider-vultr/pkg/cloud/vultrclient"
 
 	vultr "github.com/JamesClonk/vultr/lib"
 	"github.com/go-logr/logr"
+	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	capierrors "sigs.k8s.io/cluster-api/errors"
 	"sigs.k8s.io/cluster-api/util/patch"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 type ClusterScopeParams struct {
 	VultrClient  *vultr.Client
+	VultrClients *vultrclient.Pool
 	Client       client.Client
 	Logger       logr.Logger
+	Cluster      *clusterv1.Cluster
 	VultrCluster *infrav1alpha2.VultrCluster
 }
 
@@ -39,14 +44,23 @@ type ClusterScope struct {
 	VultrClient  *vultr.Client
 	client       client.Client
 	Logger       logr.Logger
+	Cluster      *clusterv1.Cluster
 	VultrCluster *infrav1alpha2.VultrCluster
 	patchHelper  *patch.Helper
 }
 
 // NewClusterScope creates a new Scope from the supplied parameters.
 func NewClusterScope(params ClusterScopeParams) (*ClusterScope, error) {
-	apiKey := os.Getenv("VULTR_API_KEY")
-	params.VultrClient = vultr.NewClient(apiKey, nil)
+	if params.VultrClient == nil {
+		if params.VultrClients == nil {
+			return nil, errors.New("vultr client pool is required when creating a ClusterScope")
+		}
+		apiKey, err := APIKey(context.TODO(), params.Client, params.VultrCluster)
+		if err != nil {
+			return nil, err
+		}
+		params.VultrClient = params.VultrClients.Get(apiKey)
+	}
 
 	helper, err := patch.NewHelper(params.VultrCluster, params.Client)
 	if err != nil {
@@ -56,6 +70,7 @@ func NewClusterScope(params ClusterScopeParams) (*ClusterScope, error) {
 	return &ClusterScope{
 		client:       params.Client,
 		Logger:       params.Logger,
+		Cluster:      params.Cluster,
 		VultrCluster: params.VultrCluster,
 		VultrClient:  params.VultrClient,
 		patchHelper:  helper,
@@ -65,3 +80,19 @@ func NewClusterScope(params ClusterScopeParams) (*ClusterScope, error) {
 func (s *ClusterScope) Close() error {
 	return s.patchHelper.Patch(context.TODO(), s.VultrCluster)
 }
+
+// SetErrorReason sets the VultrCluster status error reason.
+func (s *ClusterScope) SetErrorReason(v capierrors.ClusterStatusError) {
+	s.VultrCluster.Status.ErrorReason = &v
+}
+
+// SetErrorMessage sets the VultrCluster status error message.
+func (s *ClusterScope) SetErrorMessage(v error) {
+	s.VultrCluster.Status.ErrorMessage = pointer.StringPtr(v.Error())
+}
+
+// ClearError clears the VultrCluster status error reason and message.
+func (s *ClusterScope) ClearError() {
+	s.VultrCluster.Status.ErrorReason = nil
+	s.VultrCluster.Status.ErrorMessage = nil
+}
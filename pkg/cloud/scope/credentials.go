@@ -0,0 +1,52 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scope
+
+import (
+	"context"
+	"os"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1alpha2 "github.com/yukirii/cluster-api-provider-vultr/api/v1alpha2"
+)
+
+// APIKey returns the Vultr API key to use for the VultrCluster. It is read from
+// the credentials secret of the VultrCluster if any, and from the VULTR_API_KEY
+// environment variable of the manager otherwise.
+func APIKey(ctx context.Context, c client.Client, vultrCluster *infrav1alpha2.VultrCluster) (string, error) {
+	if vultrCluster.Spec.CredentialsSecret == nil {
+		return os.Getenv("VULTR_API_KEY"), nil
+	}
+
+	secret := &corev1.Secret{}
+	key := client.ObjectKey{
+		Namespace: vultrCluster.Namespace,
+		Name:      vultrCluster.Spec.CredentialsSecret.Name,
+	}
+	if err := c.Get(ctx, key, secret); err != nil {
+		return "", errors.Wrapf(err, "failed to get credentials secret %q", key)
+	}
+
+	apiKey, ok := secret.Data[infrav1alpha2.CredentialsSecretKey]
+	if !ok || len(apiKey) == 0 {
+		return "", errors.Errorf("credentials secret %q has no %q key", key, infrav1alpha2.CredentialsSecretKey)
+	}
+
+	return string(apiKey), nil
+}
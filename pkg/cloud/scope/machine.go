@@ -17,20 +17,27 @@ package scope
 
 import (
 	"context"
-	"os"
 
 	vultr "github.com/JamesClonk/vultr/lib"
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	capierrors "sigs.k8s.io/cluster-api/errors"
+	"sigs.k8s.io/cluster-api/util"
 	"sigs.k8s.io/cluster-api/util/patch"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	infrav1alpha2 "github.com/yukirii/cluster-api-provider-vultr/api/v1alpha2"
+	"github.com/yukirii/cluster-api-provider-vultr/pkg/cloud/tags"
+	"github.com/yukirii/cluster-api-provider-vultr/pkg/cloud/vultrclient"
 )
 
 type MachineScopeParams struct {
 	VultrClient  *vultr.Client
+	VultrClients *vultrclient.Pool
 	Client       client.Client
 	Logger       logr.Logger
 	Machine      *clusterv1.Machine
@@ -68,8 +75,16 @@ func NewMachineScope(params MachineScopeParams) (*MachineScope, error) {
 		return nil, errors.New("vultr machine is required when creating a MachineScope")
 	}
 
-	apiKey := os.Getenv("VULTR_API_KEY")
-	params.VultrClient = vultr.NewClient(apiKey, nil)
+	if params.VultrClient == nil {
+		if params.VultrClients == nil {
+			return nil, errors.New("vultr client pool is required when creating a MachineScope")
+		}
+		apiKey, err := APIKey(context.TODO(), params.Client, params.VultrCluster)
+		if err != nil {
+			return nil, err
+		}
+		params.VultrClient = params.VultrClients.Get(apiKey)
+	}
 
 	helper, err := patch.NewHelper(params.VultrMachine, params.Client)
 	if err != nil {
@@ -91,3 +106,124 @@ func NewMachineScope(params MachineScopeParams) (*MachineScope, error) {
 func (s *MachineScope) Close() error {
 	return s.patchHelper.Patch(context.TODO(), s.VultrMachine)
 }
+
+// SetErrorReason sets the VultrMachine status error reason.
+func (s *MachineScope) SetErrorReason(v capierrors.MachineStatusError) {
+	s.VultrMachine.Status.ErrorReason = &v
+}
+
+// SetErrorMessage sets the VultrMachine status error message.
+func (s *MachineScope) SetErrorMessage(v error) {
+	s.VultrMachine.Status.ErrorMessage = pointer.StringPtr(v.Error())
+}
+
+// ClearError clears the VultrMachine status error reason and message.
+func (s *MachineScope) ClearError() {
+	s.VultrMachine.Status.ErrorReason = nil
+	s.VultrMachine.Status.ErrorMessage = nil
+}
+
+// GetCondition returns the VultrMachine condition of the type, if any.
+func (s *MachineScope) GetCondition(t infrav1alpha2.ConditionType) *infrav1alpha2.Condition {
+	for i := range s.VultrMachine.Status.Conditions {
+		if s.VultrMachine.Status.Conditions[i].Type == t {
+			return &s.VultrMachine.Status.Conditions[i]
+		}
+	}
+
+	return nil
+}
+
+// SetCondition sets the VultrMachine condition of the type. The transition
+// time is only updated when the status of the condition changes.
+func (s *MachineScope) SetCondition(t infrav1alpha2.ConditionType, status corev1.ConditionStatus, reason, message string) {
+	c := s.GetCondition(t)
+	if c == nil {
+		s.VultrMachine.Status.Conditions = append(s.VultrMachine.Status.Conditions, infrav1alpha2.Condition{Type: t})
+		c = &s.VultrMachine.Status.Conditions[len(s.VultrMachine.Status.Conditions)-1]
+	}
+
+	if c.Status != status {
+		c.Status = status
+		c.LastTransitionTime = metav1.Now()
+	}
+	c.Reason = reason
+	c.Message = message
+}
+
+// IsControlPlane returns true if the Machine is a control-plane machine.
+func (s *MachineScope) IsControlPlane() bool {
+	return util.IsControlPlaneMachine(s.Machine)
+}
+
+// IsBareMetal returns true if the VultrMachine runs on a bare metal server.
+func (s *MachineScope) IsBareMetal() bool {
+	return s.VultrMachine.Spec.InstanceClass == infrav1alpha2.BareMetalInstanceClass
+}
+
+// NotifyActivate returns true if Vultr sends an email when the server is activated.
+func (s *MachineScope) NotifyActivate() bool {
+	if s.VultrMachine.Spec.NotifyActivate == nil {
+		return true
+	}
+
+	return *s.VultrMachine.Spec.NotifyActivate
+}
+
+// IPv6Enabled returns true if the server has IPv6 networking, which is always
+// the case for the machines of DualStack clusters.
+func (s *MachineScope) IPv6Enabled() bool {
+	if s.VultrCluster.Spec.IPFamily == infrav1alpha2.DualStackIPFamily {
+		return true
+	}
+
+	return s.VultrMachine.Spec.EnableIPv6
+}
+
+// Region returns the Vultr Region (DCID) of the VultrMachine, which is the one
+// of its failure domain if set, or else the one of the VultrCluster.
+func (s *MachineScope) Region() (int, error) {
+	name := s.VultrMachine.Spec.FailureDomain
+	if name == nil || *name == "" {
+		return s.VultrCluster.Spec.Region, nil
+	}
+
+	fd, ok := s.VultrCluster.Spec.FailureDomains[*name]
+	if !ok {
+		return 0, errors.Errorf("failure domain %q is not defined in VultrCluster %q", *name, s.VultrCluster.Name)
+	}
+
+	if s.IsControlPlane() && !fd.ControlPlane {
+		return 0, errors.Errorf("failure domain %q is not suitable for control-plane machines", *name)
+	}
+
+	return fd.Region, nil
+}
+
+// Tags returns the tags of the server: the additional tags of the VultrCluster
+// and VultrMachine, and the standard tags identifying the machine, which
+// take precedence over the additional ones.
+func (s *MachineScope) Tags() tags.Tags {
+	role := tags.NodeRole
+	if s.IsControlPlane() {
+		role = tags.ControlPlaneRole
+	}
+
+	return tags.Tags{}.
+		Merge(s.VultrCluster.Spec.AdditionalTags).
+		Merge(s.VultrMachine.Spec.AdditionalTags).
+		Merge(map[string]string{
+			tags.ClusterKey:    s.VultrCluster.Name,
+			tags.ClusterUIDKey: s.VultrCluster.OwnerID(),
+			tags.NamespaceKey:  s.VultrCluster.Namespace,
+			tags.RoleKey:       role,
+			tags.MachineKey:    s.VultrMachine.Name,
+		})
+}
+
+// OwnsServer returns true if the tag of the server identifies it as a server of
+// the VultrCluster. Servers with legacy tags are assumed to be owned if they
+// carry the cluster name, and are retagged once found.
+func (s *MachineScope) OwnsServer(server *vultr.Server) bool {
+	return tags.Parse(server.Tag).IsOwnedBy(s.VultrCluster.Namespace, s.VultrCluster.Name, s.VultrCluster.OwnerID())
+}
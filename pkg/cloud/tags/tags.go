@@ -0,0 +1,150 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tags encodes the tags of Vultr servers.
+//
+// A Vultr server has a single tag, so the tags of a server are encoded in it
+// as a comma-separated list of key=value pairs sorted by key, for example
+// "capv-cluster=capi,capv-namespace=default,team=infra".
+package tags
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// ClusterKey is the key of the tag holding the name of the owner VultrCluster.
+	ClusterKey = "capv-cluster"
+
+	// ClusterUIDKey is the key of the tag holding the owner ID of the owner
+	// VultrCluster, which is its UID unless the cluster has been moved.
+	ClusterUIDKey = "capv-cluster-uid"
+
+	// NamespaceKey is the key of the tag holding the namespace of the owner VultrCluster.
+	NamespaceKey = "capv-namespace"
+
+	// RoleKey is the key of the tag holding the role of the machine.
+	RoleKey = "capv-role"
+
+	// MachineKey is the key of the tag holding the name of the VultrMachine.
+	MachineKey = "capv-machine"
+)
+
+const (
+	// ControlPlaneRole is the role of control-plane machines.
+	ControlPlaneRole = "control-plane"
+
+	// NodeRole is the role of worker machines.
+	NodeRole = "node"
+)
+
+// legacyOwnedSuffix is the suffix of the "<cluster>:owned" tag which servers
+// were created with before tags were encoded.
+const legacyOwnedSuffix = ":owned"
+
+// Tags is a set of tags keyed by name.
+type Tags map[string]string
+
+// Parse decodes the tag of a server. A legacy "<cluster>:owned" tag is
+// decoded as the ClusterKey tag, and entries without a value as empty tags.
+func Parse(tag string) Tags {
+	t := Tags{}
+	if tag == "" {
+		return t
+	}
+
+	if strings.HasSuffix(tag, legacyOwnedSuffix) && !strings.ContainsAny(tag, ",=") {
+		t[ClusterKey] = strings.TrimSuffix(tag, legacyOwnedSuffix)
+		return t
+	}
+
+	for _, kv := range strings.Split(tag, ",") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) == 1 {
+			t[parts[0]] = ""
+			continue
+		}
+		t[parts[0]] = parts[1]
+	}
+
+	return t
+}
+
+// String encodes the tags as the tag of a server.
+func (t Tags) String() string {
+	keys := make([]string, 0, len(t))
+	for k := range t {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	kvs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		kvs = append(kvs, k+"="+t[k])
+	}
+
+	return strings.Join(kvs, ",")
+}
+
+// Merge returns a copy of the tags with the other tags added,
+// overriding the tags with the same key.
+func (t Tags) Merge(other map[string]string) Tags {
+	merged := Tags{}
+	for k, v := range t {
+		merged[k] = v
+	}
+	for k, v := range other {
+		merged[k] = v
+	}
+
+	return merged
+}
+
+// IsOwnedBy returns true if the tags identify a resource of the cluster.
+// Legacy tags only hold the cluster name, which is all that can be checked.
+func (t Tags) IsOwnedBy(namespace, name, ownerID string) bool {
+	if t[ClusterKey] != name {
+		return false
+	}
+
+	if t.IsLegacy() {
+		return true
+	}
+
+	return t[NamespaceKey] == namespace && t[ClusterUIDKey] == ownerID
+}
+
+// IsLegacy returns true if the tags do not hold the namespace and owner ID
+// of the cluster, as for servers created before they were recorded.
+func (t Tags) IsLegacy() bool {
+	return t[ClusterKey] != "" && t[ClusterUIDKey] == ""
+}
+
+// Validate returns an error if a tag cannot be encoded.
+func Validate(t map[string]string) error {
+	for k, v := range t {
+		if k == "" || strings.ContainsAny(k, ",=") {
+			return errors.Errorf("invalid tag key %q: it must be non-empty and must not contain ',' or '='", k)
+		}
+		if strings.Contains(v, ",") {
+			return errors.Errorf("invalid value %q of tag %q: it must not contain ','", v, k)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tags
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		tag  string
+		want Tags
+	}{
+		{"empty", "", Tags{}},
+		{"legacy", "capi:owned", Tags{ClusterKey: "capi"}},
+		{"single", "capv-cluster=capi", Tags{ClusterKey: "capi"}},
+		{
+			name: "multiple",
+			tag:  "capv-cluster=capi,capv-namespace=default,team=infra",
+			want: Tags{ClusterKey: "capi", NamespaceKey: "default", "team": "infra"},
+		},
+		{"without value", "capv-cluster=capi,pet", Tags{ClusterKey: "capi", "pet": ""}},
+		{"value with equal sign", "expr=a=b", Tags{"expr": "a=b"}},
+		{"owned suffix in pairs", "capv-cluster=capi,note=x:owned", Tags{ClusterKey: "capi", "note": "x:owned"}},
+		{"user tag", "production", Tags{"production": ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Parse(tt.tag); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) = %v, want %v", tt.tag, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStringRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		tags Tags
+		want string
+	}{
+		{"empty", Tags{}, ""},
+		{
+			name: "sorted by key",
+			tags: Tags{"team": "infra", ClusterKey: "capi", NamespaceKey: "default"},
+			want: "capv-cluster=capi,capv-namespace=default,team=infra",
+		},
+		{"empty value", Tags{ClusterKey: "capi", "pet": ""}, "capv-cluster=capi,pet="},
+		{"value with equal sign", Tags{"expr": "a=b"}, "expr=a=b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.tags.String()
+			if got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+			if parsed := Parse(got); !reflect.DeepEqual(parsed, tt.tags) {
+				t.Errorf("Parse(%q) = %v, want %v", got, parsed, tt.tags)
+			}
+		})
+	}
+}
+
+func TestLegacyTagRoundTrip(t *testing.T) {
+	encoded := Parse("capi:owned").String()
+	if encoded != "capv-cluster=capi" {
+		t.Errorf("Parse(%q).String() = %q, want %q", "capi:owned", encoded, "capv-cluster=capi")
+	}
+	if !Parse(encoded).IsLegacy() {
+		t.Errorf("Parse(%q).IsLegacy() = false, want true", encoded)
+	}
+}
+
+func TestIsOwnedBy(t *testing.T) {
+	owned := Tags{ClusterKey: "capi", NamespaceKey: "default", ClusterUIDKey: "uid"}
+
+	tests := []struct {
+		name string
+		tags Tags
+		want bool
+	}{
+		{"owned", owned, true},
+		{"legacy", Parse("capi:owned"), true},
+		{"other cluster", Tags{ClusterKey: "other", NamespaceKey: "default", ClusterUIDKey: "uid"}, false},
+		{"other namespace", owned.Merge(map[string]string{NamespaceKey: "other"}), false},
+		{"other owner ID", owned.Merge(map[string]string{ClusterUIDKey: "other"}), false},
+		{"untagged", Tags{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.tags.IsOwnedBy("default", "capi", "uid"); got != tt.want {
+				t.Errorf("IsOwnedBy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		tags    map[string]string
+		wantErr bool
+	}{
+		{"valid", map[string]string{"team": "infra", "expr": "a=b"}, false},
+		{"empty key", map[string]string{"": "x"}, true},
+		{"comma in key", map[string]string{"a,b": "x"}, true},
+		{"equal sign in key", map[string]string{"a=b": "x"}, true},
+		{"comma in value", map[string]string{"team": "a,b"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate(tt.tags); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
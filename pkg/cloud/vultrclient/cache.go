@@ -0,0 +1,157 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vultrclient
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// cacheableEndpoints are the list endpoints whose responses are cached.
+var cacheableEndpoints = map[string]bool{
+	"server/list":     true,
+	"sshkey/list":     true,
+	"reservedip/list": true,
+	"regions/list":    true,
+	"plans/list":      true,
+}
+
+// cachedResponse is a response kept by cacheTransport.
+type cachedResponse struct {
+	statusCode int
+	header     http.Header
+	body       []byte
+	expires    time.Time
+}
+
+// cacheTransport caches the responses of list endpoints for a short time.
+// Any other request may change the listed resources, so it flushes the cache.
+type cacheTransport struct {
+	next http.RoundTripper
+	ttl  time.Duration
+
+	mu        sync.Mutex
+	responses map[string]*cachedResponse
+	// generation is incremented by every flush, so that a list response
+	// fetched while the resources were changing is not cached.
+	generation uint64
+}
+
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.cacheable(req) {
+		if req.Method != http.MethodGet {
+			t.flush()
+		}
+		return t.next.RoundTrip(req)
+	}
+
+	key := req.URL.String()
+	cached, generation := t.get(key)
+	if cached != nil {
+		return cached.response(req), nil
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	cached = &cachedResponse{
+		statusCode: resp.StatusCode,
+		header:     resp.Header,
+		body:       body,
+		expires:    time.Now().Add(t.ttl),
+	}
+	t.set(key, cached, generation)
+
+	return cached.response(req), nil
+}
+
+// cacheable returns true if the response to the request can be cached.
+// Single servers are fetched from server/list too, and are never cached
+// so that their state can be polled.
+func (t *cacheTransport) cacheable(req *http.Request) bool {
+	if t.ttl <= 0 || req.Method != http.MethodGet {
+		return false
+	}
+
+	if req.URL.Query().Get("SUBID") != "" {
+		return false
+	}
+
+	return cacheableEndpoints[endpointForRequest(req)]
+}
+
+// get returns the cached response for the key if it has not expired,
+// and the current generation of the cache.
+func (t *cacheTransport) get(key string) (*cachedResponse, uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cached, ok := t.responses[key]
+	if !ok || time.Now().After(cached.expires) {
+		return nil, t.generation
+	}
+
+	return cached, t.generation
+}
+
+// set caches the response unless the cache was flushed since generation.
+func (t *cacheTransport) set(key string, cached *cachedResponse, generation uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.generation != generation {
+		return
+	}
+
+	if t.responses == nil {
+		t.responses = map[string]*cachedResponse{}
+	}
+	t.responses[key] = cached
+}
+
+func (t *cacheTransport) flush() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.responses = nil
+	t.generation++
+}
+
+// response builds a new response to the request from the cached one.
+func (c *cachedResponse) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        http.StatusText(c.statusCode),
+		StatusCode:    c.statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        c.header,
+		Body:          ioutil.NopCloser(bytes.NewReader(c.body)),
+		ContentLength: int64(len(c.body)),
+		Request:       req,
+	}
+}
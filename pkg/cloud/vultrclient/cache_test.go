@@ -0,0 +1,143 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vultrclient
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCacheTransport(t *testing.T) {
+	type request struct {
+		method   string
+		endpoint string
+	}
+
+	tests := []struct {
+		name         string
+		ttl          time.Duration
+		requests     []request
+		wantRequests int
+	}{
+		{
+			name: "list is cached",
+			ttl:  time.Minute,
+			requests: []request{
+				{http.MethodGet, "server/list"},
+				{http.MethodGet, "server/list"},
+			},
+			wantRequests: 1,
+		},
+		{
+			name: "single server is not cached",
+			ttl:  time.Minute,
+			requests: []request{
+				{http.MethodGet, "server/list?SUBID=1"},
+				{http.MethodGet, "server/list?SUBID=1"},
+			},
+			wantRequests: 2,
+		},
+		{
+			name: "POST flushes the cache",
+			ttl:  time.Minute,
+			requests: []request{
+				{http.MethodGet, "reservedip/list"},
+				{http.MethodPost, "reservedip/create"},
+				{http.MethodGet, "reservedip/list"},
+			},
+			wantRequests: 3,
+		},
+		{
+			name: "other endpoints are not cached",
+			ttl:  time.Minute,
+			requests: []request{
+				{http.MethodGet, "snapshot/list"},
+				{http.MethodGet, "snapshot/list"},
+			},
+			wantRequests: 2,
+		},
+		{
+			name: "zero TTL disables caching",
+			requests: []request{
+				{http.MethodGet, "server/list"},
+				{http.MethodGet, "server/list"},
+			},
+			wantRequests: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := &fakeTransport{}
+			transport := &cacheTransport{next: next, ttl: tt.ttl}
+
+			for _, r := range tt.requests {
+				resp, err := transport.RoundTrip(newRequest(t, r.method, r.endpoint))
+				if err != nil {
+					t.Fatalf("RoundTrip(%s %s) error = %v", r.method, r.endpoint, err)
+				}
+				if resp.StatusCode != http.StatusOK {
+					t.Errorf("RoundTrip(%s %s) status = %d, want %d", r.method, r.endpoint, resp.StatusCode, http.StatusOK)
+				}
+			}
+
+			if len(next.requests) != tt.wantRequests {
+				t.Errorf("sent %d requests, want %d", len(next.requests), tt.wantRequests)
+			}
+		})
+	}
+}
+
+// hookTransport runs hook once before sending the first request to next.
+type hookTransport struct {
+	next http.RoundTripper
+	hook func()
+}
+
+func (t *hookTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.hook != nil {
+		hook := t.hook
+		t.hook = nil
+		hook()
+	}
+
+	return t.next.RoundTrip(req)
+}
+
+func TestCacheTransportFlushDuringRequest(t *testing.T) {
+	next := &fakeTransport{}
+	hook := &hookTransport{next: next}
+	transport := &cacheTransport{next: hook, ttl: time.Minute}
+
+	// A server is created while the first list is in flight,
+	// so the list may miss it and must not be cached.
+	hook.hook = func() {
+		if _, err := transport.RoundTrip(newRequest(t, http.MethodPost, "server/create")); err != nil {
+			t.Fatalf("RoundTrip(POST server/create) error = %v", err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := transport.RoundTrip(newRequest(t, http.MethodGet, "server/list")); err != nil {
+			t.Fatalf("RoundTrip(GET server/list) error = %v", err)
+		}
+	}
+
+	if len(next.requests) != 3 {
+		t.Errorf("sent %d requests, want %d", len(next.requests), 3)
+	}
+}
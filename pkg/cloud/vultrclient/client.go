@@ -0,0 +1,188 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package vultrclient builds Vultr API clients used by the provider.
+package vultrclient
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	vultr "github.com/JamesClonk/vultr/lib"
+	"golang.org/x/time/rate"
+
+	"github.com/yukirii/cluster-api-provider-vultr/pkg/cloud/vultrerrors"
+)
+
+// Options configures the Vultr API clients.
+type Options struct {
+	// QPS is the number of requests per second allowed for each API key.
+	QPS float64
+
+	// Burst is the number of requests allowed to exceed QPS at once.
+	Burst int
+
+	// MaxRetries is how many times a request failing with a transient error is retried.
+	MaxRetries int
+
+	// CacheTTL is how long the responses of list endpoints are cached. Zero disables caching.
+	CacheTTL time.Duration
+}
+
+// DefaultOptions are the default options of the Vultr API clients.
+var DefaultOptions = Options{
+	QPS:        2,
+	Burst:      1,
+	MaxRetries: 5,
+	CacheTTL:   10 * time.Second,
+}
+
+// Pool holds long-lived Vultr API clients keyed by API key,
+// so that reconcilers share their rate limiter and cache.
+type Pool struct {
+	options Options
+
+	mu         sync.Mutex
+	clients    map[string]*vultr.Client
+	transports map[string]http.RoundTripper
+}
+
+// NewPool creates a Pool of clients configured with the options.
+func NewPool(opts Options) *Pool {
+	return &Pool{
+		options:    opts,
+		clients:    map[string]*vultr.Client{},
+		transports: map[string]http.RoundTripper{},
+	}
+}
+
+// Get returns the client for the API key, creating it if needed.
+// Errors of the client can be classified with vultrerrors.
+func (p *Pool) Get(apiKey string) *vultr.Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if c, ok := p.clients[apiKey]; ok {
+		return c
+	}
+
+	transport := newTransport(p.options)
+	c := newClient(apiKey, transport)
+	p.clients[apiKey] = c
+	p.transports[apiKey] = transport
+
+	return c
+}
+
+// WithFormValues returns a client sharing the rate limiter and cache of the
+// client, which adds the values to the form of its requests to the endpoint,
+// e.g. "server/create". It sends the parameters the library does not support.
+func (p *Pool) WithFormValues(c *vultr.Client, endpoint string, values url.Values) *vultr.Client {
+	p.Get(c.APIKey)
+
+	p.mu.Lock()
+	transport := p.transports[c.APIKey]
+	p.mu.Unlock()
+
+	return newClient(c.APIKey, &formTransport{
+		next:     transport,
+		endpoint: endpoint,
+		values:   values,
+	})
+}
+
+// Post sends a POST request with the values to the endpoint, e.g.
+// "server/backup_enable", through the transport of the client. It calls
+// the endpoints the library does not support.
+func (p *Pool) Post(c *vultr.Client, endpoint string, values url.Values) error {
+	p.Get(c.APIKey)
+
+	p.mu.Lock()
+	transport := p.transports[c.APIKey]
+	p.mu.Unlock()
+
+	u := c.Endpoint.ResolveReference(&url.URL{Path: "/v1/" + endpoint})
+	req, err := http.NewRequest(http.MethodPost, u.String(), strings.NewReader(values.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("API-Key", c.APIKey)
+	req.Header.Set("User-Agent", c.UserAgent)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+func newTransport(opts Options) http.RoundTripper {
+	return &cacheTransport{
+		ttl: opts.CacheTTL,
+		next: &retryTransport{
+			limiter:    rate.NewLimiter(rate.Limit(opts.QPS), opts.Burst),
+			maxRetries: opts.MaxRetries,
+			next: &metricsTransport{
+				next: &errorTransport{
+					next: &http.Transport{
+						Proxy:        http.ProxyFromEnvironment,
+						TLSNextProto: make(map[string]func(string, *tls.Conn) http.RoundTripper),
+					},
+				},
+			},
+		},
+	}
+}
+
+func newClient(apiKey string, transport http.RoundTripper) *vultr.Client {
+	return vultr.NewClient(apiKey, &vultr.Options{
+		HTTPClient: &http.Client{Transport: transport},
+		// Throttling is done by retryTransport, so effectively disable
+		// the limiter of the library.
+		RateLimitation: time.Nanosecond,
+	})
+}
+
+// errorTransport turns unsuccessful Vultr API responses into vultrerrors.Error.
+type errorTransport struct {
+	next http.RoundTripper
+}
+
+func (t *errorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, vultrerrors.NewTransient(err)
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, vultrerrors.NewTransient(err)
+	}
+
+	return nil, vultrerrors.New(resp.StatusCode, strings.TrimSpace(string(body)))
+}
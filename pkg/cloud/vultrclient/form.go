@@ -0,0 +1,69 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vultrclient
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// formTransport adds values to the form of the POST requests to an endpoint,
+// for the parameters which the library does not support.
+type formTransport struct {
+	next     http.RoundTripper
+	endpoint string
+	values   url.Values
+}
+
+func (t *formTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodPost || endpointForRequest(req) != t.endpoint {
+		return t.next.RoundTrip(req)
+	}
+
+	form := url.Values{}
+	if req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		form, err = url.ParseQuery(string(body))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for k, vs := range t.values {
+		form[k] = vs
+	}
+	encoded := form.Encode()
+
+	// RoundTrippers must not modify the request. GetBody is replaced too,
+	// so that retries resend the values.
+	r := new(http.Request)
+	*r = *req
+	r.Body = ioutil.NopCloser(strings.NewReader(encoded))
+	r.ContentLength = int64(len(encoded))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader(encoded)), nil
+	}
+
+	return t.next.RoundTrip(r)
+}
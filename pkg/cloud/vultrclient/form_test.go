@@ -0,0 +1,101 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vultrclient
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"golang.org/x/time/rate"
+
+	"github.com/yukirii/cluster-api-provider-vultr/pkg/cloud/vultrerrors"
+)
+
+func TestFormTransport(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		endpoint string
+		want     url.Values
+	}{
+		{"POST to the endpoint", http.MethodPost, "server/create", url.Values{"SUBID": {"1"}, "ddos_protection": {"yes"}}},
+		{"POST to another endpoint", http.MethodPost, "server/reboot", url.Values{"SUBID": {"1"}}},
+		{"GET to the endpoint", http.MethodGet, "server/create", url.Values{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := &fakeTransport{}
+			transport := &formTransport{
+				next:     next,
+				endpoint: "server/create",
+				values:   url.Values{"ddos_protection": {"yes"}},
+			}
+
+			if _, err := transport.RoundTrip(newRequest(t, tt.method, tt.endpoint)); err != nil {
+				t.Fatalf("RoundTrip() error = %v", err)
+			}
+
+			req := next.requests[0]
+			form := url.Values{}
+			if req.Body != nil {
+				body, err := ioutil.ReadAll(req.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if req.ContentLength != int64(len(body)) {
+					t.Errorf("ContentLength = %d, want %d", req.ContentLength, len(body))
+				}
+				if form, err = url.ParseQuery(string(body)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if form.Encode() != tt.want.Encode() {
+				t.Errorf("sent form %q, want %q", form.Encode(), tt.want.Encode())
+			}
+		})
+	}
+}
+
+func TestFormTransportRetry(t *testing.T) {
+	next := &fakeTransport{failures: 1, err: vultrerrors.New(http.StatusServiceUnavailable, "")}
+	transport := &formTransport{
+		next: &retryTransport{
+			next:       next,
+			limiter:    rate.NewLimiter(rate.Inf, 1),
+			maxRetries: 1,
+		},
+		endpoint: "server/create",
+		values:   url.Values{"ddos_protection": {"yes"}},
+	}
+
+	if _, err := transport.RoundTrip(newRequest(t, http.MethodPost, "server/create")); err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+
+	last := next.requests[len(next.requests)-1]
+	body, err := ioutil.ReadAll(last.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := url.Values{"SUBID": {"1"}, "ddos_protection": {"yes"}}.Encode()
+	if string(body) != want {
+		t.Errorf("retried request body = %q, want %q", body, want)
+	}
+}
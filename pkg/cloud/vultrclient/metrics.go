@@ -0,0 +1,106 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vultrclient
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/yukirii/cluster-api-provider-vultr/pkg/cloud/vultrerrors"
+)
+
+var (
+	requestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "capv_vultr_api_requests_total",
+			Help: "Total number of requests sent to the Vultr API.",
+		},
+		[]string{"endpoint"},
+	)
+
+	requestErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "capv_vultr_api_request_errors_total",
+			Help: "Total number of Vultr API requests which failed.",
+		},
+		[]string{"endpoint", "reason"},
+	)
+
+	requestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "capv_vultr_api_request_duration_seconds",
+			Help:    "Latency of the requests sent to the Vultr API.",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"endpoint"},
+	)
+
+	throttledRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "capv_vultr_api_throttled_requests_total",
+			Help: "Total number of Vultr API requests delayed by the client-side rate limiter.",
+		},
+		[]string{"endpoint"},
+	)
+
+	retriedRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "capv_vultr_api_retried_requests_total",
+			Help: "Total number of Vultr API requests retried after a transient error.",
+		},
+		[]string{"endpoint", "reason"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		requestsTotal,
+		requestErrorsTotal,
+		requestDuration,
+		throttledRequestsTotal,
+		retriedRequestsTotal,
+	)
+}
+
+// endpointForRequest returns the Vultr API endpoint of the request, e.g. "server/list".
+func endpointForRequest(req *http.Request) string {
+	return strings.TrimPrefix(req.URL.Path, "/v1/")
+}
+
+// metricsTransport records the count, errors and latency of every request
+// actually sent to the Vultr API.
+type metricsTransport struct {
+	next http.RoundTripper
+}
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint := endpointForRequest(req)
+	start := time.Now()
+
+	resp, err := t.next.RoundTrip(req)
+
+	requestsTotal.WithLabelValues(endpoint).Inc()
+	requestDuration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+	if err != nil {
+		requestErrorsTotal.WithLabelValues(endpoint, string(vultrerrors.ReasonForError(err))).Inc()
+	}
+
+	return resp, err
+}
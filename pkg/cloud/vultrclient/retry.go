@@ -0,0 +1,109 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vultrclient
+
+import (
+	"net/http"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/yukirii/cluster-api-provider-vultr/pkg/cloud/vultrerrors"
+)
+
+const (
+	// retryBaseDelay is the delay before the first retry.
+	retryBaseDelay = 500 * time.Millisecond
+
+	// retryMaxDelay caps the delay between two retries.
+	retryMaxDelay = 30 * time.Second
+
+	// retryJitter is the maximum jitter factor added to the retry delay.
+	retryJitter = 0.3
+)
+
+// retryTransport throttles requests with a token bucket shared by every request
+// made with the same API key, and retries the requests which failed with a
+// transient error.
+type retryTransport struct {
+	next       http.RoundTripper
+	limiter    *rate.Limiter
+	maxRetries int
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint := endpointForRequest(req)
+
+	for attempt := 0; ; attempt++ {
+		r := req
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = new(http.Request)
+			*r = *req
+			r.Body = body
+		}
+
+		t.wait(endpoint)
+
+		resp, err := t.next.RoundTrip(r)
+		if err == nil || attempt >= t.maxRetries || !retryable(req, err) {
+			return resp, err
+		}
+
+		reason := vultrerrors.ReasonForError(err)
+		retriedRequestsTotal.WithLabelValues(endpoint, string(reason)).Inc()
+
+		time.Sleep(backoff(attempt))
+	}
+}
+
+// wait blocks until the shared limiter allows the request to be sent.
+func (t *retryTransport) wait(endpoint string) {
+	delay := t.limiter.Reserve().Delay()
+	if delay <= 0 {
+		return
+	}
+
+	throttledRequestsTotal.WithLabelValues(endpoint).Inc()
+	time.Sleep(delay)
+}
+
+// retryable returns true if the request can be safely sent again.
+// Only rate limited requests are known not to have been processed,
+// so other transient errors are retried for read-only requests only.
+func retryable(req *http.Request, err error) bool {
+	if vultrerrors.IsRateLimited(err) {
+		return true
+	}
+
+	return req.Method == http.MethodGet && vultrerrors.IsTransient(err)
+}
+
+// backoff returns the jittered, exponentially growing delay before a retry.
+func backoff(attempt int) time.Duration {
+	delay := retryMaxDelay
+	if attempt < 16 {
+		if d := retryBaseDelay << uint(attempt); d < retryMaxDelay {
+			delay = d
+		}
+	}
+
+	return wait.Jitter(delay, retryJitter)
+}
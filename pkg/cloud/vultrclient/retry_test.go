@@ -0,0 +1,122 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vultrclient
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"golang.org/x/time/rate"
+
+	"github.com/yukirii/cluster-api-provider-vultr/pkg/cloud/vultrerrors"
+)
+
+// fakeTransport records the requests and fails the first ones with err.
+type fakeTransport struct {
+	requests []*http.Request
+	failures int
+	err      error
+}
+
+func (t *fakeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests = append(t.requests, req)
+	if len(t.requests) <= t.failures {
+		return nil, t.err
+	}
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(strings.NewReader("{}")),
+		Request:    req,
+	}, nil
+}
+
+// newRequest returns a request to the endpoint. POST requests have a body.
+func newRequest(t *testing.T, method, endpoint string) *http.Request {
+	var body io.Reader
+	if method == http.MethodPost {
+		body = strings.NewReader("SUBID=1")
+	}
+
+	req, err := http.NewRequest(method, "https://api.vultr.com/v1/"+endpoint, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return req
+}
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		err          error
+		wantRequests int
+		wantErr      bool
+	}{
+		{"GET rate limited", http.MethodGet, vultrerrors.New(http.StatusServiceUnavailable, ""), 2, false},
+		{"GET transient", http.MethodGet, vultrerrors.New(http.StatusInternalServerError, ""), 2, false},
+		{"GET not found", http.MethodGet, vultrerrors.New(http.StatusPreconditionFailed, "Invalid SUBID"), 1, true},
+		{"POST rate limited", http.MethodPost, vultrerrors.New(http.StatusServiceUnavailable, ""), 2, false},
+		{"POST transient", http.MethodPost, vultrerrors.New(http.StatusInternalServerError, ""), 1, true},
+		{"POST no response", http.MethodPost, vultrerrors.NewTransient(http.ErrHandlerTimeout), 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := &fakeTransport{failures: 1, err: tt.err}
+			transport := &retryTransport{
+				next:       next,
+				limiter:    rate.NewLimiter(rate.Inf, 1),
+				maxRetries: 1,
+			}
+
+			req := newRequest(t, tt.method, "server/list")
+			_, err := transport.RoundTrip(req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RoundTrip() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(next.requests) != tt.wantRequests {
+				t.Errorf("RoundTrip() sent %d requests, want %d", len(next.requests), tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestRetryTransportResendsBody(t *testing.T) {
+	next := &fakeTransport{failures: 1, err: vultrerrors.New(http.StatusServiceUnavailable, "")}
+	transport := &retryTransport{
+		next:       next,
+		limiter:    rate.NewLimiter(rate.Inf, 1),
+		maxRetries: 1,
+	}
+
+	if _, err := transport.RoundTrip(newRequest(t, http.MethodPost, "server/reboot")); err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+
+	last := next.requests[len(next.requests)-1]
+	body, err := ioutil.ReadAll(last.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "SUBID=1" {
+		t.Errorf("retried request body = %q, want %q", body, "SUBID=1")
+	}
+}
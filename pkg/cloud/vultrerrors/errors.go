@@ -0,0 +1,167 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package vultrerrors classifies the errors returned by the Vultr API.
+package vultrerrors
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Reason represents the class of an error returned by the Vultr API.
+type Reason string
+
+var (
+	ReasonNotFound        = Reason("NotFound")
+	ReasonRateLimited     = Reason("RateLimited")
+	ReasonUnauthorized    = Reason("Unauthorized")
+	ReasonQuotaExceeded   = Reason("QuotaExceeded")
+	ReasonInvalidArgument = Reason("InvalidArgument")
+	ReasonTransient       = Reason("Transient")
+	ReasonUnknown         = Reason("Unknown")
+)
+
+// Error is a classified error returned by the Vultr API.
+type Error struct {
+	// Reason is the class of the error.
+	Reason Reason
+
+	// StatusCode is the HTTP status code of the response, or 0 if no response was received.
+	StatusCode int
+
+	// Message is the error message returned by the Vultr API.
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// New creates an Error from the status code and body of a Vultr API response.
+func New(statusCode int, message string) *Error {
+	if message == "" {
+		message = http.StatusText(statusCode)
+	}
+
+	return &Error{
+		Reason:     classify(statusCode, message),
+		StatusCode: statusCode,
+		Message:    message,
+	}
+}
+
+// NewTransient creates an Error for a request which didn't get any response.
+func NewTransient(err error) *Error {
+	return &Error{
+		Reason:  ReasonTransient,
+		Message: err.Error(),
+	}
+}
+
+// classify maps a Vultr API response to a Reason. The Vultr API returns 412
+// for most failed requests, so the message is used to tell them apart. A 412
+// is also returned for transient conditions, e.g. a locked server, so the
+// ones which are not recognized are left unknown.
+func classify(statusCode int, message string) Reason {
+	switch statusCode {
+	case http.StatusForbidden:
+		return ReasonUnauthorized
+	case http.StatusServiceUnavailable:
+		return ReasonRateLimited
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return ReasonTransient
+	case http.StatusBadRequest, http.StatusMethodNotAllowed:
+		return ReasonInvalidArgument
+	case http.StatusPreconditionFailed:
+		msg := strings.ToLower(message)
+		switch {
+		case strings.Contains(msg, "invalid server"),
+			strings.Contains(msg, "invalid subid"),
+			strings.Contains(msg, "not found"),
+			strings.Contains(msg, "does not exist"):
+			return ReasonNotFound
+		case strings.Contains(msg, "limit"),
+			strings.Contains(msg, "quota"),
+			strings.Contains(msg, "maximum"),
+			strings.Contains(msg, "insufficient"):
+			return ReasonQuotaExceeded
+		case strings.Contains(msg, "invalid"):
+			return ReasonInvalidArgument
+		}
+	}
+
+	return ReasonUnknown
+}
+
+// cause returns the underlying Error, unwrapping pkg/errors and net/url errors.
+func cause(err error) *Error {
+	for err != nil {
+		switch e := errors.Cause(err).(type) {
+		case *Error:
+			return e
+		case *url.Error:
+			err = e.Err
+		default:
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// ReasonForError returns the Reason of the error, or ReasonUnknown if it is
+// not an error returned by the Vultr API.
+func ReasonForError(err error) Reason {
+	if e := cause(err); e != nil {
+		return e.Reason
+	}
+
+	return ReasonUnknown
+}
+
+// IsNotFound returns true if the requested resource doesn't exist.
+func IsNotFound(err error) bool {
+	return ReasonForError(err) == ReasonNotFound
+}
+
+// IsRateLimited returns true if the request hit the API rate limit.
+func IsRateLimited(err error) bool {
+	return ReasonForError(err) == ReasonRateLimited
+}
+
+// IsUnauthorized returns true if the API key is invalid or lacks permissions.
+func IsUnauthorized(err error) bool {
+	return ReasonForError(err) == ReasonUnauthorized
+}
+
+// IsQuotaExceeded returns true if an account limit has been reached.
+func IsQuotaExceeded(err error) bool {
+	return ReasonForError(err) == ReasonQuotaExceeded
+}
+
+// IsInvalidArgument returns true if the request was rejected as invalid.
+func IsInvalidArgument(err error) bool {
+	return ReasonForError(err) == ReasonInvalidArgument
+}
+
+// IsTransient returns true if the request may succeed when retried as is.
+func IsTransient(err error) bool {
+	reason := ReasonForError(err)
+	return reason == ReasonTransient || reason == ReasonRateLimited
+}
@@ -0,0 +1,97 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vultrerrors
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		message    string
+		want       Reason
+	}{
+		{"forbidden", http.StatusForbidden, "Invalid API key", ReasonUnauthorized},
+		{"service unavailable", http.StatusServiceUnavailable, "Rate limit reached", ReasonRateLimited},
+		{"internal server error", http.StatusInternalServerError, "", ReasonTransient},
+		{"bad gateway", http.StatusBadGateway, "", ReasonTransient},
+		{"gateway timeout", http.StatusGatewayTimeout, "", ReasonTransient},
+		{"bad request", http.StatusBadRequest, "", ReasonInvalidArgument},
+		{"method not allowed", http.StatusMethodNotAllowed, "", ReasonInvalidArgument},
+		{"invalid server", http.StatusPreconditionFailed, "Invalid server.  Check SUBID value and ensure your API key matches the server's account", ReasonNotFound},
+		{"invalid subid", http.StatusPreconditionFailed, "Invalid SUBID", ReasonNotFound},
+		{"not found", http.StatusPreconditionFailed, "Reserved IP not found", ReasonNotFound},
+		{"does not exist", http.StatusPreconditionFailed, "Snapshot does not exist", ReasonNotFound},
+		{"limit", http.StatusPreconditionFailed, "You have reached the maximum monthly fee limit for this account", ReasonQuotaExceeded},
+		{"quota", http.StatusPreconditionFailed, "Server quota exceeded", ReasonQuotaExceeded},
+		{"insufficient", http.StatusPreconditionFailed, "Insufficient funds", ReasonQuotaExceeded},
+		{"invalid argument", http.StatusPreconditionFailed, "Invalid plan chosen", ReasonInvalidArgument},
+		{"locked server", http.StatusPreconditionFailed, "Server is currently locked", ReasonUnknown},
+		{"unmatched precondition", http.StatusPreconditionFailed, "Unable to attach", ReasonUnknown},
+		{"other status", http.StatusTeapot, "", ReasonUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classify(tt.statusCode, tt.message); got != tt.want {
+				t.Errorf("classify(%d, %q) = %s, want %s", tt.statusCode, tt.message, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReasonForError(t *testing.T) {
+	notFound := New(http.StatusPreconditionFailed, "Invalid SUBID")
+
+	tests := []struct {
+		name string
+		err  error
+		want Reason
+	}{
+		{"nil", nil, ReasonUnknown},
+		{"error", notFound, ReasonNotFound},
+		{"wrapped", errors.Wrap(notFound, "failed to get server"), ReasonNotFound},
+		{"url error", &url.Error{Op: "Get", URL: "https://api.vultr.com/v1/server/list", Err: notFound}, ReasonNotFound},
+		{"wrapped url error", errors.Wrap(&url.Error{Op: "Post", URL: "https://api.vultr.com/v1/server/create", Err: notFound}, "failed"), ReasonNotFound},
+		{"transient", NewTransient(errors.New("connection reset by peer")), ReasonTransient},
+		{"other error", errors.New("boom"), ReasonUnknown},
+		{"url error of other error", &url.Error{Op: "Get", URL: "https://api.vultr.com/v1/server/list", Err: errors.New("boom")}, ReasonUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ReasonForError(tt.err); got != tt.want {
+				t.Errorf("ReasonForError(%v) = %s, want %s", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	err := New(http.StatusInternalServerError, "")
+	if err.Message != http.StatusText(http.StatusInternalServerError) {
+		t.Errorf("New() message = %q, want the status text", err.Message)
+	}
+	if err.StatusCode != http.StatusInternalServerError {
+		t.Errorf("New() status code = %d, want %d", err.StatusCode, http.StatusInternalServerError)
+	}
+}